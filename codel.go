@@ -0,0 +1,109 @@
+package cpumassager
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// CoDel 基于排队时延的准入控制，实现了Controlled Delay算法，适用于从进程内队列中
+// 取任务处理的场景：任务出队时报告其入队时间，如果最小排队时延在interval内一直超过
+// target，就开始丢弃任务，并且按照interval/sqrt(丢弃次数)的间隔逐渐加快丢弃，
+// 直到排队时延回落到target以下
+// CPU疲累时会按照按摩力度收紧target，按摩力度为100时target减半
+type CoDel struct {
+	mu sync.Mutex
+	// target 可以接受的排队时延，例如5毫秒
+	target time.Duration
+	// interval 排队时延持续超过target多久之后开始丢弃，例如100毫秒
+	interval time.Duration
+
+	// firstAboveTime 排队时延超过target之后，持续到该时间就需要开始丢弃，为零值表示未超过
+	firstAboveTime time.Time
+	dropping       bool
+	dropNext       time.Time
+	dropCount      int
+
+	plan *massagePlan
+	now  func() time.Time
+}
+
+// NewCoDel 新建一个基于排队时延的准入控制，target是可以接受的排队时延，
+// interval是排队时延持续超过target多久之后开始丢弃，推荐5毫秒和100毫秒
+func NewCoDel(target, interval time.Duration) (*CoDel, error) {
+	if target <= 0 || interval <= 0 {
+		return nil, fmt.Errorf("target and interval should greater than 0")
+	}
+	return &CoDel{
+		target:   target,
+		interval: interval,
+		plan:     planInst,
+		now:      time.Now,
+	}, nil
+}
+
+// getTarget 获取当前的target，CPU疲累时按照按摩力度收紧
+func (c *CoDel) getTarget() time.Duration {
+	intensity := c.plan.getIntensity()
+	return c.target * time.Duration(2*fullIntensity-intensity) / (2 * fullIntensity)
+}
+
+// controlLaw 计算下一次丢弃的时间，丢弃次数越多间隔越短
+func (c *CoDel) controlLaw(t time.Time) time.Time {
+	return t.Add(time.Duration(float64(c.interval) / math.Sqrt(float64(c.dropCount))))
+}
+
+// okToDrop 根据排队时延判断是否已经持续超过target达到interval
+func (c *CoDel) okToDrop(now time.Time, sojourn time.Duration) bool {
+	if sojourn < c.getTarget() {
+		c.firstAboveTime = time.Time{}
+		return false
+	}
+	if c.firstAboveTime.IsZero() {
+		c.firstAboveTime = now.Add(c.interval)
+		return false
+	}
+	return !now.Before(c.firstAboveTime)
+}
+
+// shouldDrop 根据CoDel算法判断是否需要丢弃入队时间为enqueueTime的任务
+func (c *CoDel) shouldDrop(enqueueTime time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	okToDrop := c.okToDrop(now, now.Sub(enqueueTime))
+	if c.dropping {
+		if !okToDrop {
+			c.dropping = false
+			return false
+		}
+		if !now.Before(c.dropNext) {
+			c.dropCount++
+			c.dropNext = c.controlLaw(c.dropNext)
+			return true
+		}
+		return false
+	}
+	if !okToDrop {
+		return false
+	}
+	c.dropping = true
+	// 刚退出丢弃状态不久又需要丢弃，从接近上次的丢弃频率开始
+	if c.dropCount > 2 && now.Sub(c.dropNext) < c.interval {
+		c.dropCount -= 2
+	} else {
+		c.dropCount = 1
+	}
+	c.dropNext = c.controlLaw(now)
+	return true
+}
+
+// NeedMassage 任务出队准备处理的时候调用，enqueueTime是任务的入队时间，
+// 返回true表示需要丢弃该任务，排队时延和CPU状态任意一个判断需要拒绝都会返回true
+func (c *CoDel) NeedMassage(enqueueTime time.Time) bool {
+	if c.shouldDrop(enqueueTime) {
+		return c.plan.finishDecision(c.plan.getIntensity(), true)
+	}
+	return c.plan.NeedMassage()
+}
@@ -0,0 +1,68 @@
+package cpumassager
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCoDel(t *testing.T) {
+	require := require.New(t)
+	_, err := NewCoDel(0, 100*time.Millisecond)
+	require.NotNil(err)
+
+	c, err := NewCoDel(5*time.Millisecond, 100*time.Millisecond)
+	require.Nil(err)
+	c.plan = &massagePlan{currentState: stateRelaxed{}}
+	now := time.Now()
+	c.now = func() time.Time { return now }
+	dequeue := func(sojourn time.Duration) bool {
+		return c.NeedMassage(now.Add(-sojourn))
+	}
+
+	// 排队时延低于target的任务都会处理
+	require.False(dequeue(time.Millisecond))
+	// 排队时延超过target，但是持续时间不到interval，先不丢弃
+	require.False(dequeue(10 * time.Millisecond))
+	now = now.Add(50 * time.Millisecond)
+	require.False(dequeue(10 * time.Millisecond))
+	// 持续超过interval，开始丢弃
+	now = now.Add(50 * time.Millisecond)
+	require.True(dequeue(10 * time.Millisecond))
+	// 下一次丢弃在interval/sqrt(1)之后
+	now = now.Add(50 * time.Millisecond)
+	require.False(dequeue(10 * time.Millisecond))
+	now = now.Add(50 * time.Millisecond)
+	require.True(dequeue(10 * time.Millisecond))
+	// 再下一次丢弃在interval/sqrt(2)之后
+	now = now.Add(71 * time.Millisecond)
+	require.True(dequeue(10 * time.Millisecond))
+	// 排队时延回落后退出丢弃状态
+	require.False(dequeue(time.Millisecond))
+	require.False(c.dropping)
+}
+
+func TestCoDelTightenedByTiredCPU(t *testing.T) {
+	require := require.New(t)
+	c, err := NewCoDel(10*time.Millisecond, 100*time.Millisecond)
+	require.Nil(err)
+	mp := &massagePlan{opts: options{initialIntensity: 100}, currentState: stateRelaxed{}}
+	c.plan = mp
+	require.Equal(10*time.Millisecond, c.getTarget())
+	mp.SetTired()
+	require.Equal(5*time.Millisecond, c.getTarget())
+	mp.currentIntensity = 50
+	require.Equal(7500*time.Microsecond, c.getTarget())
+
+	// CPU疲累时即使排队时延不高也会按照按摩力度拒绝
+	now := time.Now()
+	c.now = func() time.Time { return now }
+	rejected := 0
+	for i := 0; i < 100; i++ {
+		if c.NeedMassage(now) {
+			rejected++
+		}
+	}
+	require.Equal(50, rejected)
+}
@@ -0,0 +1,148 @@
+package cpumassager
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// LimitAlgorithm 并发限制算法，参照Netflix concurrency-limits的做法，
+// 根据请求的往返时延(RTT)和在途请求数动态地调整并发限制
+// Update会在concurrencyLimiter的锁内被调用，实现不需要考虑并发
+type LimitAlgorithm interface {
+	// Update 每个请求处理完成的时候调用，rtt是请求的处理时长，inflight是请求开始时的
+	// 在途请求数(包括该请求)，limit是当前的并发限制，返回新的并发限制
+	Update(rtt time.Duration, inflight int, limit float64) float64
+}
+
+// gradientLimit 梯度并发限制算法，比较短期RTT和长期RTT的比值(梯度)：
+// 短期RTT明显变大说明开始排队，按梯度降低并发限制，否则缓慢地提高并发限制
+type gradientLimit struct {
+	// tolerance 短期RTT相对于长期RTT可以容忍的倍数
+	tolerance float64
+	// smoothing 新限制的平滑系数
+	smoothing float64
+	// longRTTAlpha 长期RTT的指数加权移动平均系数
+	longRTTAlpha float64
+
+	longRTT float64
+}
+
+// NewGradientLimit 新建一个梯度并发限制算法
+func NewGradientLimit() LimitAlgorithm {
+	return &gradientLimit{
+		tolerance:    1.5,
+		smoothing:    0.2,
+		longRTTAlpha: 0.01,
+	}
+}
+
+func (g *gradientLimit) Update(rtt time.Duration, inflight int, limit float64) float64 {
+	shortRTT := float64(rtt)
+	if shortRTT <= 0 {
+		return limit
+	}
+	if g.longRTT == 0 {
+		g.longRTT = shortRTT
+	} else {
+		g.longRTT = g.longRTT*(1-g.longRTTAlpha) + shortRTT*g.longRTTAlpha
+	}
+	// 在途请求数远低于并发限制的时候，说明限制不是瓶颈，不需要再提高
+	if float64(inflight) < limit/2 {
+		return limit
+	}
+	gradient := math.Max(0.5, math.Min(1.0, g.tolerance*g.longRTT/shortRTT))
+	queueSize := math.Sqrt(limit)
+	newLimit := limit*gradient + queueSize
+	return limit*(1-g.smoothing) + newLimit*g.smoothing
+}
+
+// vegasLimit Vegas并发限制算法，以观察到的最小RTT作为无负载时的RTT，
+// 估算排队的请求数：排队少则提高并发限制，排队多则降低并发限制
+type vegasLimit struct {
+	noLoadRTT time.Duration
+}
+
+// NewVegasLimit 新建一个Vegas并发限制算法
+func NewVegasLimit() LimitAlgorithm {
+	return &vegasLimit{}
+}
+
+func (v *vegasLimit) Update(rtt time.Duration, inflight int, limit float64) float64 {
+	if rtt <= 0 {
+		return limit
+	}
+	if v.noLoadRTT == 0 || rtt < v.noLoadRTT {
+		v.noLoadRTT = rtt
+		return limit
+	}
+	queueSize := limit * (1 - float64(v.noLoadRTT)/float64(rtt))
+	logLimit := math.Max(1, math.Log10(limit))
+	alpha := 3 * logLimit
+	beta := 6 * logLimit
+	switch {
+	case queueSize <= alpha && float64(inflight)*2 >= limit:
+		return limit + logLimit
+	case queueSize >= beta:
+		return limit - logLimit
+	}
+	return limit
+}
+
+// concurrencyLimiter 自适应并发限制器，按照LimitAlgorithm调整并发限制，
+// 在途请求数达到并发限制的时候拒绝新的请求
+type concurrencyLimiter struct {
+	mu        sync.Mutex
+	algorithm LimitAlgorithm
+	limit     float64
+	minLimit  float64
+	maxLimit  float64
+	inflight  int
+	now       func() time.Time
+}
+
+func newConcurrencyLimiter(algorithm LimitAlgorithm, initialLimit, minLimit, maxLimit uint) *concurrencyLimiter {
+	return &concurrencyLimiter{
+		algorithm: algorithm,
+		limit:     float64(initialLimit),
+		minLimit:  float64(minLimit),
+		maxLimit:  float64(maxLimit),
+		now:       time.Now,
+	}
+}
+
+// getLimit 获取当前的并发限制
+func (l *concurrencyLimiter) getLimit() float64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.limit
+}
+
+// acquire 尝试获取一个并发名额，intensity是CPU疲累时的按摩力度，作为额外的上限，
+// 会把并发限制按比例收紧，获取成功的话需要在请求处理完成后调用release
+func (l *concurrencyLimiter) acquire(intensity uint) (release func(), ok bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	limit := l.limit * float64(fullIntensity-intensity) / fullIntensity
+	if float64(l.inflight) >= limit {
+		return nil, false
+	}
+	l.inflight++
+	inflight := l.inflight
+	startTime := l.now()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			l.release(l.now().Sub(startTime), inflight)
+		})
+	}, true
+}
+
+// release 归还一个并发名额，并根据请求的处理时长调整并发限制
+func (l *concurrencyLimiter) release(rtt time.Duration, inflight int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.inflight--
+	limit := l.algorithm.Update(rtt, inflight, l.limit)
+	l.limit = math.Max(l.minLimit, math.Min(l.maxLimit, limit))
+}
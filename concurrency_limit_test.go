@@ -0,0 +1,127 @@
+package cpumassager
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGradientLimit(t *testing.T) {
+	assert := assert.New(t)
+	g := NewGradientLimit()
+	// RTT稳定并且在途请求数接近限制的时候，缓慢提高并发限制
+	limit := 100.0
+	for i := 0; i < 10; i++ {
+		limit = g.Update(10*time.Millisecond, int(limit), limit)
+	}
+	assert.Greater(limit, 100.0)
+	// 在途请求数远低于限制的时候保持不变
+	assert.Equal(limit, g.Update(10*time.Millisecond, 1, limit))
+	// RTT突然变大说明开始排队，降低并发限制
+	assert.Less(g.Update(100*time.Millisecond, int(limit), limit), limit)
+	assert.Equal(limit, g.Update(0, int(limit), limit))
+}
+
+func TestVegasLimit(t *testing.T) {
+	assert := assert.New(t)
+	v := NewVegasLimit()
+	assert.Equal(100.0, v.Update(10*time.Millisecond, 100, 100))
+	// 没有排队，提高并发限制
+	assert.Equal(102.0, v.Update(10*time.Millisecond, 100, 100))
+	// 在途请求数远低于限制的时候不提高
+	assert.Equal(100.0, v.Update(10*time.Millisecond, 10, 100))
+	// 排队的请求数超过beta，降低并发限制
+	assert.Equal(98.0, v.Update(20*time.Millisecond, 100, 100))
+	// 排队的请求数在alpha和beta之间，保持不变
+	assert.Equal(100.0, v.Update(11*time.Millisecond, 100, 100))
+}
+
+// fixedLimit 每次都返回固定并发限制的算法
+type fixedLimit struct {
+	limit float64
+	rtts  []time.Duration
+}
+
+func (f *fixedLimit) Update(rtt time.Duration, inflight int, limit float64) float64 {
+	f.rtts = append(f.rtts, rtt)
+	return f.limit
+}
+
+func TestConcurrencyLimiter(t *testing.T) {
+	require := require.New(t)
+	algorithm := &fixedLimit{limit: 100}
+	l := newConcurrencyLimiter(algorithm, 2, 1, 10)
+	now := time.Now()
+	l.now = func() time.Time { return now }
+
+	release1, ok := l.acquire(0)
+	require.True(ok)
+	release2, ok := l.acquire(0)
+	require.True(ok)
+	_, ok = l.acquire(0)
+	require.False(ok)
+
+	// 归还名额时按照处理时长调整并发限制，并限制在[minLimit, maxLimit]内
+	now = now.Add(10 * time.Millisecond)
+	release1()
+	release1()
+	require.Equal([]time.Duration{10 * time.Millisecond}, algorithm.rtts)
+	require.Equal(10.0, l.getLimit())
+
+	// CPU疲累时按照按摩力度收紧并发限制
+	release3, ok := l.acquire(80)
+	require.True(ok)
+	_, ok = l.acquire(80)
+	require.False(ok)
+	release2()
+	release3()
+	_, ok = l.acquire(fullIntensity)
+	require.False(ok)
+}
+
+func TestMassagePlanAcquire(t *testing.T) {
+	require := require.New(t)
+	mp := massagePlan{
+		opts: options{
+			cpusageCollector:     collectorFunc(func() float64 { return 0 }),
+			loadStatusJudgeRatio: 0.2,
+			initialIntensity:     50,
+		},
+		currentState: stateRelaxed{},
+	}
+
+	// 没有启用并发限制的时候和NeedMassage的判断一致
+	release, ok := mp.Acquire(context.Background())
+	require.True(ok)
+	release()
+	mp.SetTired()
+	_, ok = mp.Acquire(context.Background())
+	require.False(ok)
+	_, ok = mp.Acquire(context.Background())
+	require.True(ok)
+
+	WithConcurrencyLimit(NewVegasLimit(), 1, 1, 10)(&mp.opts)
+	require.True(mp.opts.isValid())
+	mp.SetRelaxed()
+	release, ok = mp.Acquire(context.Background())
+	require.True(ok)
+	_, ok = mp.Acquire(context.Background())
+	require.False(ok)
+	release()
+
+	// 已经取消的请求直接拒绝
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, ok = mp.Acquire(ctx)
+	require.False(ok)
+
+	WithConcurrencyLimit(nil, 1, 1, 10)(&mp.opts)
+	require.False(mp.opts.isValid())
+	WithConcurrencyLimit(NewGradientLimit(), 20, 1, 10)(&mp.opts)
+	require.False(mp.opts.isValid())
+	WithConcurrencyLimit(NewGradientLimit(), 1, 0, 10)(&mp.opts)
+	require.False(mp.opts.isValid())
+}
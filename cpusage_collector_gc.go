@@ -0,0 +1,64 @@
+package cpumassager
+
+import (
+	"runtime"
+	"time"
+)
+
+// processStartTime 程序的启动时间，和runtime内部记录的启动时间相差无几，
+// 用来把MemStats.GCCPUFraction换算成GC累计使用的CPU时间
+var processStartTime = time.Now()
+
+// gcCPUData GC的CPU使用相关数据
+type gcCPUData struct {
+	// gcCPUSeconds 程序启动以来GC累计使用的CPU时间，以秒为单位
+	gcCPUSeconds float64
+	procs        int
+	collectTime  time.Time
+}
+
+// getCurGCCPUData 获取当前的gcCPUData
+// GCCPUFraction是程序启动以来GC使用的CPU时间占GOMAXPROCS*运行时长的比例
+func getCurGCCPUData() *gcCPUData {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	d := &gcCPUData{
+		procs:       runtime.GOMAXPROCS(0),
+		collectTime: time.Now(),
+	}
+	d.gcCPUSeconds = ms.GCCPUFraction * d.collectTime.Sub(processStartTime).Seconds() * float64(d.procs)
+	return d
+}
+
+// gcCPUsageCollector GC的CPU使用率收集器，返回两次采集之间GC使用的CPU时间占
+// 程序可用CPU时间的百分比，程序启动以来的GCCPUFraction反映不了最近的情况
+type gcCPUsageCollector struct {
+	lastCPUData *gcCPUData
+}
+
+func (c *gcCPUsageCollector) GetCPUsage() float64 {
+	curCPUData := getCurGCCPUData()
+	lastCPUData := c.lastCPUData
+	c.lastCPUData = curCPUData
+	return calcGCCPUsage(lastCPUData, curCPUData)
+}
+
+// calcGCCPUsage 根据前后两次采集的数据计算GC的CPU使用率
+func calcGCCPUsage(last, cur *gcCPUData) float64 {
+	availableSeconds := cur.collectTime.Sub(last.collectTime).Seconds() * float64(cur.procs)
+	gcDelta := cur.gcCPUSeconds - last.gcCPUSeconds
+	if availableSeconds <= 0 || gcDelta <= 0 {
+		return 0.0
+	}
+	usage := gcDelta / availableSeconds * 100.0
+	if usage > 100.0 {
+		return 100.0
+	}
+	return usage
+}
+
+// NewGCCPUsageCollector 新建一个GC的CPU使用率收集器
+// 每次采集都会调用runtime.ReadMemStats，会有一次短暂的STW
+func NewGCCPUsageCollector() CPUsageCollector {
+	return &gcCPUsageCollector{lastCPUData: getCurGCCPUData()}
+}
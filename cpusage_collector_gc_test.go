@@ -0,0 +1,32 @@
+package cpumassager
+
+import (
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCalcGCCPUsage(t *testing.T) {
+	assert := assert.New(t)
+	now := time.Now()
+	last := &gcCPUData{gcCPUSeconds: 1.0, procs: 4, collectTime: now}
+	// 1秒内4个P可用4秒的CPU时间，GC用了1秒
+	cur := &gcCPUData{gcCPUSeconds: 2.0, procs: 4, collectTime: now.Add(time.Second)}
+	assert.InDelta(25.0, calcGCCPUsage(last, cur), 0.001)
+	assert.Equal(0.0, calcGCCPUsage(cur, last))
+	assert.Equal(0.0, calcGCCPUsage(cur, cur))
+}
+
+func TestGetGCCPUsage(t *testing.T) {
+	assert := assert.New(t)
+	c := NewGCCPUsageCollector()
+	for i := 0; i < 10; i++ {
+		_ = make([]byte, 1<<20)
+		runtime.GC()
+	}
+	usage := c.GetCPUsage()
+	assert.LessOrEqual(0.0, usage)
+	assert.GreaterOrEqual(100.0, usage)
+}
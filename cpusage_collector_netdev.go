@@ -0,0 +1,140 @@
+package cpumassager
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	bitsPerByte        = 8
+	bytesPerMegabit    = 1e6 / bitsPerByte
+	netDevFile         = "/proc/net/dev"
+	netDevRxBytesIndex = 0 // /proc/net/dev中网卡名之后第1列是接收字节数
+	netDevTxBytesIndex = 8 // /proc/net/dev中网卡名之后第9列是发送字节数
+)
+
+// netDevData 网卡的流量相关数据
+type netDevData struct {
+	rxBytes     uint64
+	txBytes     uint64
+	collectTime time.Time
+}
+
+// parseNetDevData 从/proc/net/dev的文件内容中解析出指定网卡的收发字节数
+func parseNetDevData(content string, ifName string) (*netDevData, error) {
+	for _, line := range strings.Split(content, "\n") {
+		sepIndex := strings.Index(line, ":")
+		if sepIndex < 0 || strings.TrimSpace(line[:sepIndex]) != ifName {
+			continue
+		}
+		fields := strings.Fields(line[sepIndex+1:])
+		if len(fields) <= netDevTxBytesIndex {
+			return nil, fmt.Errorf("invalid line of interface:%s, line:%s", ifName, line)
+		}
+		rxBytes, err := strconv.ParseUint(fields[netDevRxBytesIndex], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("parse rx bytes of interface:%s error:%s", ifName, err.Error())
+		}
+		txBytes, err := strconv.ParseUint(fields[netDevTxBytesIndex], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("parse tx bytes of interface:%s error:%s", ifName, err.Error())
+		}
+		return &netDevData{rxBytes: rxBytes, txBytes: txBytes}, nil
+	}
+	return nil, fmt.Errorf("interface:%s not found in %s", ifName, netDevFile)
+}
+
+// getCurNetDevData 获取指定网卡当前的netDevData
+func getCurNetDevData(ifName string) (*netDevData, error) {
+	v, err := ioutil.ReadFile(netDevFile)
+	if err != nil {
+		return nil, fmt.Errorf("ReadFile:%s, error:%s", netDevFile, err.Error())
+	}
+	d, err := parseNetDevData(string(v), ifName)
+	if err != nil {
+		return nil, err
+	}
+	d.collectTime = time.Now()
+	return d, nil
+}
+
+// getLinkSpeedInMbps 从/sys/class/net/<if>/speed获取网卡的链路速率，以Mbps为单位
+func getLinkSpeedInMbps(ifName string) (uint64, error) {
+	speedFile := fmt.Sprintf("/sys/class/net/%s/speed", ifName)
+	v, err := ioutil.ReadFile(speedFile)
+	if err != nil {
+		return 0, fmt.Errorf("ReadFile:%s, error:%s", speedFile, err.Error())
+	}
+	speed, err := strconv.ParseInt(strings.TrimSpace(string(v)), 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	if speed <= 0 {
+		return 0, fmt.Errorf("unknown link speed:%d of interface:%s", speed, ifName)
+	}
+	return uint64(speed), nil
+}
+
+// netDevUsageCollector 网卡使用率收集器，以收发两个方向中流量较大者占链路速率的
+// 百分比作为使用率，使得按摩计划可以依据网卡的饱和程度来拒绝服务
+type netDevUsageCollector struct {
+	ifName string
+	// linkBytesPerSecond 链路速率，以字节每秒为单位
+	linkBytesPerSecond float64
+	lastNetDevData     *netDevData
+}
+
+func (c *netDevUsageCollector) GetCPUsage() float64 {
+	curNetDevData, err := getCurNetDevData(c.ifName)
+	if err != nil {
+		return 0.0
+	}
+	lastNetDevData := c.lastNetDevData
+	c.lastNetDevData = curNetDevData
+	if lastNetDevData == nil {
+		return 0.0
+	}
+	return c.calcUsage(lastNetDevData, curNetDevData)
+}
+
+// calcUsage 根据前后两次采集的数据计算网卡使用率
+func (c *netDevUsageCollector) calcUsage(last, cur *netDevData) float64 {
+	seconds := cur.collectTime.Sub(last.collectTime).Seconds()
+	if seconds <= 0 || cur.rxBytes < last.rxBytes || cur.txBytes < last.txBytes {
+		return 0.0
+	}
+	maxDelta := cur.rxBytes - last.rxBytes
+	if txDelta := cur.txBytes - last.txBytes; txDelta > maxDelta {
+		maxDelta = txDelta
+	}
+	usage := float64(maxDelta) / seconds / c.linkBytesPerSecond * 100.0
+	if usage > 100.0 {
+		return 100.0
+	}
+	return usage
+}
+
+// NewNetDevUsageCollector 新建一个网卡使用率收集器
+// linkSpeedInMbps为网卡的链路速率，以Mbps为单位，传0则从/sys/class/net/<if>/speed读取
+func NewNetDevUsageCollector(ifName string, linkSpeedInMbps uint64) (CPUsageCollector, error) {
+	if linkSpeedInMbps == 0 {
+		speed, err := getLinkSpeedInMbps(ifName)
+		if err != nil {
+			return nil, fmt.Errorf("getLinkSpeedInMbps error:%s", err.Error())
+		}
+		linkSpeedInMbps = speed
+	}
+	curNetDevData, err := getCurNetDevData(ifName)
+	if err != nil {
+		return nil, fmt.Errorf("getCurNetDevData error:%s", err.Error())
+	}
+	c := &netDevUsageCollector{
+		ifName:             ifName,
+		linkBytesPerSecond: float64(linkSpeedInMbps) * bytesPerMegabit,
+		lastNetDevData:     curNetDevData,
+	}
+	return c, nil
+}
@@ -0,0 +1,64 @@
+package cpumassager
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testNetDevContent = `Inter-|   Receive                                                |  Transmit
+ face |bytes    packets errs drop fifo frame compressed multicast|bytes    packets errs drop fifo colls carrier compressed
+    lo: 1724929     624    0    0    0     0          0         0  1724929     624    0    0    0     0       0          0
+  eth0:396413     161    0    0    0     0          0         0    19465     183    0    0    0     0       0          0
+`
+
+func TestParseNetDevData(t *testing.T) {
+	require := require.New(t)
+	d, err := parseNetDevData(testNetDevContent, "eth0")
+	require.Nil(err)
+	require.Equal(uint64(396413), d.rxBytes)
+	require.Equal(uint64(19465), d.txBytes)
+
+	d, err = parseNetDevData(testNetDevContent, "lo")
+	require.Nil(err)
+	require.Equal(uint64(1724929), d.rxBytes)
+	require.Equal(uint64(1724929), d.txBytes)
+
+	_, err = parseNetDevData(testNetDevContent, "eth1")
+	require.NotNil(err)
+}
+
+func TestNetDevCalcUsage(t *testing.T) {
+	assert := assert.New(t)
+	c := &netDevUsageCollector{linkBytesPerSecond: 1000 * bytesPerMegabit}
+	now := time.Now()
+	last := &netDevData{rxBytes: 0, txBytes: 0, collectTime: now}
+	// 1秒内发送了500Mb，接收了100Mb，使用率取较大的发送方向
+	cur := &netDevData{rxBytes: 100 * bytesPerMegabit, txBytes: 500 * bytesPerMegabit,
+		collectTime: now.Add(time.Second)}
+	assert.InDelta(50.0, c.calcUsage(last, cur), 0.001)
+
+	// 超过链路速率的按100计算
+	cur.rxBytes = 2000 * bytesPerMegabit
+	assert.Equal(100.0, c.calcUsage(last, cur))
+
+	// 计数器回绕或者时间异常的情况返回0
+	assert.Equal(0.0, c.calcUsage(cur, last))
+}
+
+func TestGetNetDevUsage(t *testing.T) {
+	assert := assert.New(t)
+	c, err := NewNetDevUsageCollector("lo", 1000)
+	if !assert.Nil(err) {
+		assert.FailNow("NewNetDevUsageCollector return error")
+	}
+	time.Sleep(time.Duration(time.Millisecond * 10))
+	usage := c.GetCPUsage()
+	assert.LessOrEqual(0.0, usage)
+	assert.GreaterOrEqual(100.0, usage)
+
+	_, err = NewNetDevUsageCollector("not-exist-interface", 0)
+	assert.NotNil(err)
+}
@@ -0,0 +1,159 @@
+package cpumassager
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultRemoteTimeout  = 500 * time.Millisecond
+	maxRemoteResponseSize = 4096
+)
+
+// remoteCPUsageResponse 节点代理返回的JSON格式的CPU使用率
+type remoteCPUsageResponse struct {
+	Usage *float64 `json:"usage"`
+}
+
+// parseRemoteCPUsage 解析节点代理返回的CPU使用率，支持纯数字或者{"usage":...}的JSON格式
+func parseRemoteCPUsage(body []byte) (float64, error) {
+	content := strings.TrimSpace(string(body))
+	usage, err := strconv.ParseFloat(content, 64)
+	if err != nil {
+		var resp remoteCPUsageResponse
+		if err := json.Unmarshal([]byte(content), &resp); err != nil || resp.Usage == nil {
+			return 0, fmt.Errorf("invalid response:%q", content)
+		}
+		usage = *resp.Usage
+	}
+	if math.IsNaN(usage) || math.IsInf(usage, 0) || usage < 0 || usage > 100 {
+		return 0, fmt.Errorf("usage:%f out of range [0, 100]", usage)
+	}
+	return usage, nil
+}
+
+// remoteCPUsageCollector 远程CPU使用率收集器，通过HTTP或者Unix socket向节点上的代理
+// 询问当前的CPU使用率，使得容器内的服务可以依据其在cgroup内看不到的节点级信息来拒绝服务
+type remoteCPUsageCollector struct {
+	endpoint   string
+	socketPath string
+	timeout    time.Duration
+	// cacheTTL 缓存时长，距离上次成功获取的时间不超过该值则直接返回上次的结果
+	cacheTTL time.Duration
+	// fallback 访问节点代理失败时使用的本地收集器，为nil时返回0
+	fallback CPUsageCollector
+	client   *http.Client
+
+	lastUsage     float64
+	lastFetchTime time.Time
+	now           func() time.Time
+}
+
+// RemoteOption 用来设定远程收集器参数的函数
+type RemoteOption func(*remoteCPUsageCollector)
+
+// WithRemoteTimeout 用来设定访问节点代理的超时时间，默认500毫秒
+func WithRemoteTimeout(timeout time.Duration) RemoteOption {
+	return func(c *remoteCPUsageCollector) {
+		c.timeout = timeout
+	}
+}
+
+// WithRemoteCacheTTL 用来设定节点代理返回结果的缓存时长，默认不缓存
+func WithRemoteCacheTTL(cacheTTL time.Duration) RemoteOption {
+	return func(c *remoteCPUsageCollector) {
+		c.cacheTTL = cacheTTL
+	}
+}
+
+// WithRemoteFallback 用来设定访问节点代理失败时使用的本地收集器
+func WithRemoteFallback(fallback CPUsageCollector) RemoteOption {
+	return func(c *remoteCPUsageCollector) {
+		c.fallback = fallback
+	}
+}
+
+// WithRemoteUnixSocket 用来设定通过Unix socket访问节点代理，此时endpoint中的host会被忽略
+func WithRemoteUnixSocket(socketPath string) RemoteOption {
+	return func(c *remoteCPUsageCollector) {
+		c.socketPath = socketPath
+	}
+}
+
+func (c *remoteCPUsageCollector) GetCPUsage() float64 {
+	now := c.now()
+	if !c.lastFetchTime.IsZero() && now.Sub(c.lastFetchTime) < c.cacheTTL {
+		return c.lastUsage
+	}
+	usage, err := c.fetchCPUsage()
+	if err != nil {
+		if c.fallback != nil {
+			return c.fallback.GetCPUsage()
+		}
+		return 0.0
+	}
+	c.lastUsage = usage
+	c.lastFetchTime = now
+	return usage
+}
+
+// fetchCPUsage 向节点代理询问当前的CPU使用率
+func (c *remoteCPUsageCollector) fetchCPUsage() (float64, error) {
+	resp, err := c.client.Get(c.endpoint)
+	if err != nil {
+		return 0, fmt.Errorf("get %s error:%s", c.endpoint, err.Error())
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("get %s status:%d", c.endpoint, resp.StatusCode)
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxRemoteResponseSize))
+	if err != nil {
+		return 0, fmt.Errorf("read response error:%s", err.Error())
+	}
+	return parseRemoteCPUsage(body)
+}
+
+// NewRemoteCPUsageCollector 新建一个远程CPU使用率收集器，endpoint是节点代理的HTTP地址，
+// 例如"http://127.0.0.1:8080/cpusage"，通过Unix socket访问时配合WithRemoteUnixSocket使用
+func NewRemoteCPUsageCollector(endpoint string, opts ...RemoteOption) (CPUsageCollector, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("parse endpoint:%s error:%s", endpoint, err.Error())
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("scheme of endpoint:%s should be http or https", endpoint)
+	}
+	c := &remoteCPUsageCollector{
+		endpoint: endpoint,
+		timeout:  defaultRemoteTimeout,
+		now:      time.Now,
+	}
+	for _, o := range opts {
+		o(c)
+	}
+	if c.timeout <= 0 {
+		return nil, fmt.Errorf("timeout should be greater than 0")
+	}
+
+	transport := &http.Transport{}
+	if c.socketPath != "" {
+		socketPath := c.socketPath
+		transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", socketPath)
+		}
+	}
+	c.client = &http.Client{Transport: transport, Timeout: c.timeout}
+	return c, nil
+}
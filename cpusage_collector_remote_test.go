@@ -0,0 +1,124 @@
+package cpumassager
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRemoteCPUsage(t *testing.T) {
+	var testCases = []struct {
+		in       string
+		expected float64
+		valid    bool
+	}{
+		{"75.5\n", 75.5, true},
+		{`{"usage":30}`, 30, true},
+		{`{"load":30}`, 0, false},
+		{"101", 0, false},
+		{"-1", 0, false},
+		{"busy", 0, false},
+		{"NaN", 0, false},
+		{"Inf", 0, false},
+		{"-Inf", 0, false},
+	}
+	for _, testCase := range testCases {
+		usage, err := parseRemoteCPUsage([]byte(testCase.in))
+		assert.Equalf(t, testCase.valid, err == nil, "in:%q", testCase.in)
+		assert.Equalf(t, testCase.expected, usage, "in:%q", testCase.in)
+	}
+}
+
+// newStubAgentHandler 模拟节点代理，依次返回usages中的CPU使用率，并记录被访问的次数
+func newStubAgentHandler(usages []float64, requestCount *int32) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		i := atomic.AddInt32(requestCount, 1) - 1
+		fmt.Fprintf(w, "%f", usages[int(i)%len(usages)])
+	})
+}
+
+func TestRemoteCPUsageCollectorHTTP(t *testing.T) {
+	assert := assert.New(t)
+	var requestCount int32
+	server := httptest.NewServer(newStubAgentHandler([]float64{10, 20, 30}, &requestCount))
+	defer server.Close()
+
+	c, err := NewRemoteCPUsageCollector(server.URL + "/cpusage")
+	require.Nil(t, err)
+	assert.Equal(10.0, c.GetCPUsage())
+	assert.Equal(20.0, c.GetCPUsage())
+	assert.Equal(int32(2), atomic.LoadInt32(&requestCount))
+
+	// 缓存有效期内不会访问节点代理
+	c, err = NewRemoteCPUsageCollector(server.URL, WithRemoteCacheTTL(time.Minute))
+	require.Nil(t, err)
+	assert.Equal(30.0, c.GetCPUsage())
+	assert.Equal(30.0, c.GetCPUsage())
+	assert.Equal(int32(3), atomic.LoadInt32(&requestCount))
+
+	_, err = NewRemoteCPUsageCollector("tcp://127.0.0.1:80")
+	assert.NotNil(err)
+	_, err = NewRemoteCPUsageCollector(server.URL, WithRemoteTimeout(0))
+	assert.NotNil(err)
+}
+
+func TestRemoteCPUsageCollectorUnixSocket(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cpumassager")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	socketPath := filepath.Join(dir, "agent.sock")
+	listener, err := net.Listen("unix", socketPath)
+	require.Nil(t, err)
+	var requestCount int32
+	server := &http.Server{Handler: newStubAgentHandler([]float64{66}, &requestCount)}
+	go server.Serve(listener)
+	defer server.Close()
+
+	c, err := NewRemoteCPUsageCollector("http://agent/cpusage", WithRemoteUnixSocket(socketPath))
+	require.Nil(t, err)
+	assert.Equal(t, 66.0, c.GetCPUsage())
+}
+
+func TestRemoteCPUsageCollectorFallback(t *testing.T) {
+	assert := assert.New(t)
+	mockCtl := gomock.NewController(t)
+	defer mockCtl.Finish()
+	mockCollector := NewMockCPUsageCollector(mockCtl)
+	mockCollector.EXPECT().GetCPUsage().Return(42.0).Times(2)
+
+	// 节点代理响应超时
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+		fmt.Fprint(w, "10")
+	}))
+	defer server.Close()
+	c, err := NewRemoteCPUsageCollector(server.URL, WithRemoteTimeout(10*time.Millisecond),
+		WithRemoteFallback(mockCollector))
+	require.Nil(t, err)
+	assert.Equal(42.0, c.GetCPUsage())
+
+	// 节点代理返回错误
+	errServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer errServer.Close()
+	c, err = NewRemoteCPUsageCollector(errServer.URL, WithRemoteFallback(mockCollector))
+	require.Nil(t, err)
+	assert.Equal(42.0, c.GetCPUsage())
+
+	// 没有设定本地收集器的时候返回0
+	c, err = NewRemoteCPUsageCollector(errServer.URL)
+	require.Nil(t, err)
+	assert.Equal(0.0, c.GetCPUsage())
+}
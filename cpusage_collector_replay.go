@@ -0,0 +1,230 @@
+package cpumassager
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// replaySample 回放轨迹中的一条CPU使用率记录
+type replaySample struct {
+	// offset 相对于轨迹中第一条记录的时间偏移
+	offset time.Duration
+	usage  float64
+}
+
+// replayJSONLine JSON-lines格式轨迹中的一行，timestamp可以是unix秒数或者RFC3339格式的字符串
+type replayJSONLine struct {
+	Timestamp json.RawMessage `json:"timestamp"`
+	Usage     *float64        `json:"usage"`
+}
+
+// parseReplayTimestamp 解析轨迹中的时间戳，支持unix秒数(可带小数)和RFC3339格式
+func parseReplayTimestamp(s string) (time.Time, error) {
+	s = strings.Trim(strings.TrimSpace(s), `"`)
+	if seconds, err := strconv.ParseFloat(s, 64); err == nil {
+		return time.Unix(0, int64(seconds*nanoSecondsPerSecond)), nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid timestamp:%s", s)
+	}
+	return t, nil
+}
+
+// parseReplayLine 解析轨迹中的一行，支持"timestamp,usage"的CSV格式和
+// {"timestamp":...,"usage":...}的JSON格式
+func parseReplayLine(line string) (time.Time, float64, error) {
+	if strings.HasPrefix(line, "{") {
+		var l replayJSONLine
+		if err := json.Unmarshal([]byte(line), &l); err != nil {
+			return time.Time{}, 0, fmt.Errorf("json.Unmarshal error:%s", err.Error())
+		}
+		if l.Timestamp == nil || l.Usage == nil {
+			return time.Time{}, 0, fmt.Errorf("timestamp or usage missing")
+		}
+		if !isFiniteUsage(*l.Usage) {
+			return time.Time{}, 0, fmt.Errorf("invalid usage:%v", *l.Usage)
+		}
+		timestamp, err := parseReplayTimestamp(string(l.Timestamp))
+		return timestamp, *l.Usage, err
+	}
+
+	fields := strings.Split(line, ",")
+	if len(fields) != 2 {
+		return time.Time{}, 0, fmt.Errorf("csv line should have 2 fields")
+	}
+	timestamp, err := parseReplayTimestamp(fields[0])
+	if err != nil {
+		return time.Time{}, 0, err
+	}
+	usage, err := strconv.ParseFloat(strings.TrimSpace(fields[1]), 64)
+	if err != nil || !isFiniteUsage(usage) {
+		return time.Time{}, 0, fmt.Errorf("invalid usage:%s", fields[1])
+	}
+	return timestamp, usage, nil
+}
+
+// isFiniteUsage CPU使用率是否是有限的数值，NaN和Inf都是无效的
+func isFiniteUsage(usage float64) bool {
+	return !math.IsNaN(usage) && !math.IsInf(usage, 0)
+}
+
+// isReplayHeader 第一行是否是CSV的表头，第一个字段不是时间戳的才是表头
+func isReplayHeader(line string) bool {
+	if strings.HasPrefix(line, "{") {
+		return false
+	}
+	_, err := parseReplayTimestamp(strings.Split(line, ",")[0])
+	return err != nil
+}
+
+// parseReplaySamples 读取整个轨迹，空行和以#开头的注释行会被忽略，
+// 第一行的第一个字段不是时间戳的话会被当作CSV的表头忽略
+func parseReplaySamples(r io.Reader) ([]replaySample, error) {
+	var (
+		samples       []replaySample
+		firstTime     time.Time
+		headerSkipped = false
+		lineNum       = 0
+		scanner       = bufio.NewScanner(r)
+	)
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		timestamp, usage, err := parseReplayLine(line)
+		if err != nil {
+			if len(samples) == 0 && !headerSkipped && isReplayHeader(line) {
+				headerSkipped = true
+				continue
+			}
+			return nil, fmt.Errorf("parse line:%d error:%s", lineNum, err.Error())
+		}
+		if len(samples) == 0 {
+			firstTime = timestamp
+		}
+		offset := timestamp.Sub(firstTime)
+		if len(samples) > 0 && offset < samples[len(samples)-1].offset {
+			return nil, fmt.Errorf("timestamp of line:%d goes backwards", lineNum)
+		}
+		samples = append(samples, replaySample{offset: offset, usage: usage})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read trace error:%s", err.Error())
+	}
+	if len(samples) == 0 {
+		return nil, fmt.Errorf("no sample in trace")
+	}
+	return samples, nil
+}
+
+// replayCPUsageCollector 回放CPU使用率轨迹的收集器，按顺序返回事先录制的CPU使用率，
+// 用来重放线上事故时的CPU曲线以评估不同的启动参数，或者复现特定序列下的状态扭转问题
+type replayCPUsageCollector struct {
+	samples []replaySample
+	// loop 轨迹回放完之后是否从头开始循环回放
+	loop bool
+	// followTiming 是否按照轨迹中原始的时间间隔回放，否则每次调用返回下一条记录
+	followTiming bool
+
+	nextIndex int
+	startTime time.Time
+	now       func() time.Time
+}
+
+// ReplayOption 用来设定回放收集器参数的函数
+type ReplayOption func(*replayCPUsageCollector)
+
+// WithReplayLoop 用来设定轨迹回放完之后是否循环回放
+func WithReplayLoop(loop bool) ReplayOption {
+	return func(c *replayCPUsageCollector) {
+		c.loop = loop
+	}
+}
+
+// WithReplayFollowTiming 用来设定是否按照轨迹中原始的时间间隔回放
+func WithReplayFollowTiming(followTiming bool) ReplayOption {
+	return func(c *replayCPUsageCollector) {
+		c.followTiming = followTiming
+	}
+}
+
+func (c *replayCPUsageCollector) GetCPUsage() float64 {
+	if c.followTiming {
+		return c.getCPUsageByTiming()
+	}
+	if c.nextIndex >= len(c.samples) {
+		if !c.loop {
+			return 0.0
+		}
+		c.nextIndex = 0
+	}
+	usage := c.samples[c.nextIndex].usage
+	c.nextIndex++
+	return usage
+}
+
+// getCPUsageByTiming 返回轨迹中相对于第一次调用经过的时间所对应的记录
+func (c *replayCPUsageCollector) getCPUsageByTiming() float64 {
+	if c.startTime.IsZero() {
+		c.startTime = c.now()
+	}
+	elapsed := c.now().Sub(c.startTime)
+	lastOffset := c.samples[len(c.samples)-1].offset
+	if elapsed > lastOffset {
+		if !c.loop {
+			return 0.0
+		}
+		if lastOffset <= 0 {
+			return c.samples[len(c.samples)-1].usage
+		}
+		// 最后一条记录之后留出一个平均采样间隔，再回到第一条记录
+		period := lastOffset + lastOffset/time.Duration(len(c.samples)-1)
+		elapsed %= period
+	}
+	index := sort.Search(len(c.samples), func(i int) bool {
+		return c.samples[i].offset > elapsed
+	})
+	if index == 0 {
+		return c.samples[0].usage
+	}
+	return c.samples[index-1].usage
+}
+
+// NewReplayCPUsageCollector 新建一个回放CPU使用率轨迹的收集器
+// 轨迹每行一条记录，可以是"timestamp,usage"的CSV格式或者{"timestamp":...,"usage":...}
+// 的JSON-lines格式，timestamp是unix秒数或者RFC3339格式的时间
+func NewReplayCPUsageCollector(r io.Reader, opts ...ReplayOption) (CPUsageCollector, error) {
+	samples, err := parseReplaySamples(r)
+	if err != nil {
+		return nil, fmt.Errorf("parseReplaySamples error:%s", err.Error())
+	}
+	c := &replayCPUsageCollector{
+		samples: samples,
+		now:     time.Now,
+	}
+	for _, o := range opts {
+		o(c)
+	}
+	return c, nil
+}
+
+// NewReplayCPUsageCollectorFromFile 从轨迹文件新建一个回放CPU使用率轨迹的收集器
+func NewReplayCPUsageCollectorFromFile(traceFile string, opts ...ReplayOption) (CPUsageCollector, error) {
+	f, err := os.Open(traceFile)
+	if err != nil {
+		return nil, fmt.Errorf("open %s error:%s", traceFile, err.Error())
+	}
+	defer f.Close()
+	return NewReplayCPUsageCollector(f, opts...)
+}
@@ -0,0 +1,136 @@
+package cpumassager
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseReplaySamples(t *testing.T) {
+	require := require.New(t)
+	csvTrace := `timestamp,usage
+# 注释行会被忽略
+1600000000,10.5
+1600000001.5,90
+
+2020-09-13T12:26:43Z,50
+`
+	samples, err := parseReplaySamples(strings.NewReader(csvTrace))
+	require.Nil(err)
+	require.Equal([]replaySample{
+		{offset: 0, usage: 10.5},
+		{offset: 1500 * time.Millisecond, usage: 90},
+		{offset: 3 * time.Second, usage: 50},
+	}, samples)
+
+	jsonTrace := `{"timestamp":1600000000,"usage":20}
+{"timestamp":"2020-09-13T12:26:42Z","usage":80.5}`
+	samples, err = parseReplaySamples(strings.NewReader(jsonTrace))
+	require.Nil(err)
+	require.Equal([]replaySample{
+		{offset: 0, usage: 20},
+		{offset: 2 * time.Second, usage: 80.5},
+	}, samples)
+
+	var invalidTraces = []string{
+		"",
+		"timestamp,usage\n",
+		"1600000000,10\nbad,line\n",
+		"1600000001,10\n1600000000,20\n",
+		`{"timestamp":1600000000}`,
+		"1,oops\n1600000000,10\n",
+		"1600000000,NaN\n",
+		"1600000000,10\n1600000001,+Inf\n",
+		`{"timestamp":1600000000,"usage":1e400}`,
+	}
+	for _, trace := range invalidTraces {
+		_, err = parseReplaySamples(strings.NewReader(trace))
+		require.NotNilf(err, "trace:%q should be invalid", trace)
+	}
+}
+
+func TestReplayCPUsageCollector(t *testing.T) {
+	assert := assert.New(t)
+	const trace = "0,10\n1,20\n2,30\n"
+	c, err := NewReplayCPUsageCollector(strings.NewReader(trace))
+	require.Nil(t, err)
+	for _, expected := range []float64{10, 20, 30, 0, 0} {
+		assert.Equal(expected, c.GetCPUsage())
+	}
+
+	c, err = NewReplayCPUsageCollector(strings.NewReader(trace), WithReplayLoop(true))
+	require.Nil(t, err)
+	for _, expected := range []float64{10, 20, 30, 10, 20} {
+		assert.Equal(expected, c.GetCPUsage())
+	}
+}
+
+func TestReplayCPUsageCollectorFollowTiming(t *testing.T) {
+	assert := assert.New(t)
+	const trace = "0,10\n1,20\n3,30\n"
+	var cases = []struct {
+		loop     bool
+		elapsed  time.Duration
+		expected float64
+	}{
+		{false, 0, 10},
+		{false, 500 * time.Millisecond, 10},
+		{false, 1 * time.Second, 20},
+		{false, 2900 * time.Millisecond, 20},
+		{false, 3 * time.Second, 30},
+		{false, 5 * time.Second, 0},
+		// 循环回放时，最后一条记录之后留出平均采样间隔1.5秒，4.5秒后重新开始
+		{true, 4 * time.Second, 30},
+		{true, 4500 * time.Millisecond, 10},
+		{true, 5500 * time.Millisecond, 20},
+	}
+	for _, testCase := range cases {
+		c, err := NewReplayCPUsageCollector(strings.NewReader(trace),
+			WithReplayFollowTiming(true), WithReplayLoop(testCase.loop))
+		require.Nil(t, err)
+		startTime := time.Now()
+		now := startTime
+		c.(*replayCPUsageCollector).now = func() time.Time { return now }
+		c.GetCPUsage()
+		now = startTime.Add(testCase.elapsed)
+		assert.Equalf(testCase.expected, c.GetCPUsage(), "loop:%v, elapsed:%v",
+			testCase.loop, testCase.elapsed)
+	}
+}
+
+func TestReplayTraceThroughMassagePlan(t *testing.T) {
+	require := require.New(t)
+	// 先持续高负荷使得计划进入疲累状态，然后持续低负荷直到恢复轻松状态
+	var lines []string
+	for i := 0; i < 30; i++ {
+		lines = append(lines, "0,95")
+	}
+	for i := 0; i < 200; i++ {
+		lines = append(lines, "0,5")
+	}
+	c, err := NewReplayCPUsageCollector(strings.NewReader(strings.Join(lines, "\n")))
+	require.Nil(err)
+
+	mp := massagePlan{
+		opts: options{
+			cpusageCollector:     c,
+			highLoadLevel:        CounterTypeEighty,
+			loadStatusJudgeRatio: 0.2,
+			initialIntensity:     50,
+			stepIntensity:        10,
+		},
+		cpusageRecorder:  cpusageRecorder{},
+		currentState:     stateRelaxed{},
+		currentIntensity: 50,
+	}
+	becameTired := false
+	for i := 0; i < len(lines); i++ {
+		mp.AddACPUsageRecord()
+		becameTired = becameTired || mp.isTired()
+	}
+	require.True(becameTired)
+	require.True(mp.isRelaxed())
+}
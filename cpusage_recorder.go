@@ -1,8 +1,53 @@
 package cpumassager
 
-// cpusageRecorder cpu使用率记录器
+import "sort"
+
+// Recorder CPU使用率记录器的接口，massagePlan依据记录器的读数来判断CPU的高低负荷，
+// 不同的实现代表了不同的平滑方式，可以根据服务的特点来选择
+type Recorder interface {
+	// AddRecord 添加一条CPU使用率的记录，非法的记录(<0或者>100)会被忽略
+	AddRecord(cpusage float64)
+	// GetLoadRatio 获取最近一段时间内CPU使用率>=threshold的记录所占的比例，取值范围是[0, 1]，
+	// IsHighLoad用它判断是否高负荷，疲累状态下isHighLoadRatioIncreased用它和上次调整按摩力度
+	// 时的比例比较来决定提高还是降低按摩力度
+	GetLoadRatio(threshold float64) float64
+}
+
+// thresholdWatcher 需要事先知道关注哪些阈值的记录器，massagePlan启动的时候会把高负荷阈值告知记录器
+type thresholdWatcher interface {
+	addThreshold(threshold float64)
+}
+
+// defaultRecordCap 计数器默认的上限，也就是默认观察最近100次采集的CPU使用率
+const defaultRecordCap = 100
+
+// cpusageRecorder cpu使用率记录器，每个计数器对应一个CPU使用率阈值，零值的记录器
+// 使用CounterType对应的10个阈值，计数器上限为defaultRecordCap
 type cpusageRecorder struct {
-	recordCounters [10]int
+	// thresholds 各个计数器对应的CPU使用率阈值，从小到大排列
+	thresholds     []float64
+	recordCounters []int
+	// recordCap 计数器的上限，计数器是一个饱和的加减计数器，上限决定了观察窗口的长度
+	recordCap int
+}
+
+// NewCounterRecorder 新建一个以饱和加减计数器记录CPU使用率的记录器，也就是默认的记录器，
+// recordCap是计数器的上限，thresholds是除了CounterType对应的阈值之外额外记录的阈值
+func NewCounterRecorder(recordCap uint, thresholds ...float64) Recorder {
+	r := newCPUsageRecorder(thresholds, int(recordCap))
+	return &r
+}
+
+// newCPUsageRecorder 新建一个记录指定阈值的记录器，CounterType对应的阈值总是会被记录
+func newCPUsageRecorder(thresholds []float64, recordCap int) cpusageRecorder {
+	r := cpusageRecorder{recordCap: recordCap}
+	for _, counterType := range allCounterTypes() {
+		r.addThreshold(counterType.threshold())
+	}
+	for _, threshold := range thresholds {
+		r.addThreshold(threshold)
+	}
+	return r
 }
 
 // CounterType 计数器类型，用来记录满足不同条件的CPU使用率情况
@@ -40,6 +85,11 @@ const (
 	CounterTypeNinety CounterType = 9
 )
 
+// threshold 返回计数器类型对应的CPU使用率阈值
+func (ct CounterType) threshold() float64 {
+	return float64(ct) * 10
+}
+
 // allCounterTypes 返回所有的计数器类型
 func allCounterTypes() []CounterType {
 	return []CounterType{
@@ -56,20 +106,46 @@ func allCounterTypes() []CounterType {
 	}
 }
 
+// addThreshold 添加一个阈值的计数器，已经存在的阈值会被忽略
+func (r *cpusageRecorder) addThreshold(threshold float64) {
+	index := sort.SearchFloat64s(r.thresholds, threshold)
+	if index < len(r.thresholds) && r.thresholds[index] == threshold {
+		return
+	}
+	r.thresholds = append(r.thresholds, 0)
+	copy(r.thresholds[index+1:], r.thresholds[index:])
+	r.thresholds[index] = threshold
+	r.recordCounters = append(r.recordCounters, 0)
+	copy(r.recordCounters[index+1:], r.recordCounters[index:])
+	r.recordCounters[index] = 0
+}
+
+// getRecordCap 获取计数器的上限
+func (r *cpusageRecorder) getRecordCap() int {
+	if r.recordCap <= 0 {
+		return defaultRecordCap
+	}
+	return r.recordCap
+}
+
 // AddRecord 添加一条cpu使用率的记录
 func (r *cpusageRecorder) AddRecord(cpusage float64) {
 	if cpusage < 0 || cpusage > 100 {
 		return
 	}
+	if r.thresholds == nil {
+		*r = newCPUsageRecorder(nil, r.recordCap)
+	}
 
-	for _, counterType := range allCounterTypes() {
-		if cpusage >= float64(counterType)*10 {
-			if r.recordCounters[counterType] < 100 {
-				r.recordCounters[counterType]++
+	recordCap := r.getRecordCap()
+	for i, threshold := range r.thresholds {
+		if cpusage >= threshold {
+			if r.recordCounters[i] < recordCap {
+				r.recordCounters[i]++
 			}
 		} else {
-			if r.recordCounters[counterType] > 0 {
-				r.recordCounters[counterType]--
+			if r.recordCounters[i] > 0 {
+				r.recordCounters[i]--
 			}
 		}
 	}
@@ -77,5 +153,19 @@ func (r *cpusageRecorder) AddRecord(cpusage float64) {
 
 // GetRecordNumOfCounterType 获取制定计数器的记录数
 func (r *cpusageRecorder) GetRecordNumOfCounterType(ct CounterType) int {
-	return r.recordCounters[ct]
+	return r.GetRecordNumOfThreshold(ct.threshold())
+}
+
+// GetRecordNumOfThreshold 获取指定阈值的计数器的记录数，没有记录该阈值则返回0
+func (r *cpusageRecorder) GetRecordNumOfThreshold(threshold float64) int {
+	index := sort.SearchFloat64s(r.thresholds, threshold)
+	if index < len(r.thresholds) && r.thresholds[index] == threshold {
+		return r.recordCounters[index]
+	}
+	return 0
+}
+
+// GetLoadRatio 获取CPU使用率>=threshold的计数器读数占计数器上限的比例
+func (r *cpusageRecorder) GetLoadRatio(threshold float64) float64 {
+	return float64(r.GetRecordNumOfThreshold(threshold)) / float64(r.getRecordCap())
 }
@@ -0,0 +1,89 @@
+package cpumassager
+
+import (
+	"fmt"
+	"math"
+	"sync"
+)
+
+// ewmaBinNum EWMA记录器的分桶数，每个桶对应1%的CPU使用率，100%单独一个桶
+const ewmaBinNum = 101
+
+// EWMARecorder 指数加权移动平均记录器，每条记录按照CPU使用率落入对应的桶中，
+// 所有桶的权重每添加一条记录就衰减一次，越新的记录权重越大，
+// 阈值和分位数的精度都是1%的CPU使用率
+type EWMARecorder struct {
+	mu sync.Mutex
+	// alpha 新记录的权重，取值范围是(0, 1]，越大越关注最近的记录
+	alpha       float64
+	bins        [ewmaBinNum]float64
+	totalWeight float64
+	average     float64
+}
+
+// NewEWMARecorder 新建一个指数加权移动平均记录器，alpha是新记录的权重，取值范围是(0, 1]，
+// 例如0.05大约相当于关注最近20次记录
+func NewEWMARecorder(alpha float64) (*EWMARecorder, error) {
+	if alpha <= 0 || alpha > 1 {
+		return nil, fmt.Errorf("alpha should in (0, 1], 0.05 is recommended")
+	}
+	return &EWMARecorder{alpha: alpha}, nil
+}
+
+// AddRecord 添加一条CPU使用率的记录
+func (r *EWMARecorder) AddRecord(cpusage float64) {
+	if cpusage < 0 || cpusage > 100 {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	decay := 1 - r.alpha
+	for i := range r.bins {
+		r.bins[i] *= decay
+	}
+	r.bins[int(cpusage)] += r.alpha
+	if r.totalWeight == 0 {
+		r.average = cpusage
+	} else {
+		r.average = r.average*decay + cpusage*r.alpha
+	}
+	r.totalWeight = r.totalWeight*decay + r.alpha
+}
+
+// GetLoadRatio 获取CPU使用率>=threshold的记录的加权占比，没有记录的历史按照非高负荷计算，
+// 也就是不按照已有记录的总权重归一化，刚启动的时候不会因为一两条高负荷的记录就得到很高的占比
+func (r *EWMARecorder) GetLoadRatio(threshold float64) float64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	weight := 0.0
+	for i := int(math.Max(0, math.Ceil(threshold))); i < ewmaBinNum; i++ {
+		weight += r.bins[i]
+	}
+	return math.Min(1, weight)
+}
+
+// GetAverage 获取CPU使用率的指数加权移动平均值
+func (r *EWMARecorder) GetAverage() float64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.average
+}
+
+// GetPercentile 获取加权之后CPU使用率的分位数，percentile取值范围是[0, 100]，
+// 返回的是满足条件的最低1%粒度的CPU使用率
+func (r *EWMARecorder) GetPercentile(percentile float64) float64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.totalWeight == 0 {
+		return 0
+	}
+	target := r.totalWeight * percentile / 100
+	weight := 0.0
+	for i := range r.bins {
+		weight += r.bins[i]
+		if weight >= target {
+			return float64(i)
+		}
+	}
+	return 100
+}
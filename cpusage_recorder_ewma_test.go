@@ -0,0 +1,41 @@
+package cpumassager
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEWMARecorder(t *testing.T) {
+	assert := assert.New(t)
+	_, err := NewEWMARecorder(0)
+	assert.NotNil(err)
+	_, err = NewEWMARecorder(1.1)
+	assert.NotNil(err)
+
+	recorder, err := NewEWMARecorder(0.5)
+	require.Nil(t, err)
+	assert.Equal(0.0, recorder.GetLoadRatio(0))
+	assert.Equal(0.0, recorder.GetPercentile(50))
+
+	// 没有记录的历史按照非高负荷计算，一条高负荷的记录只占新记录的权重
+	recorder.AddRecord(90)
+	assert.Equal(0.5, recorder.GetLoadRatio(85))
+	assert.Equal(90.0, recorder.GetAverage())
+	// 新记录的权重是0.5，旧记录衰减为0.25
+	recorder.AddRecord(50)
+	assert.InDelta(0.25, recorder.GetLoadRatio(85), 1e-9)
+	assert.InDelta(0.75, recorder.GetLoadRatio(50), 1e-9)
+	assert.InDelta(0.0, recorder.GetLoadRatio(90.5), 1e-9)
+	assert.InDelta(70.0, recorder.GetAverage(), 1e-9)
+	assert.Equal(50.0, recorder.GetPercentile(50))
+	assert.Equal(90.0, recorder.GetPercentile(90))
+
+	// 非法的记录不影响读数
+	recorder.AddRecord(-1)
+	recorder.AddRecord(101)
+	assert.InDelta(0.25, recorder.GetLoadRatio(85), 1e-9)
+	recorder.AddRecord(100)
+	assert.Equal(100.0, recorder.GetPercentile(100))
+}
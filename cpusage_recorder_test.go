@@ -41,3 +41,23 @@ func TestCPUsageRecorder(t *testing.T) {
 		assert.Equal(t, testCase.expected, recorder.GetRecordNumOfCounterType(testCase.in))
 	}
 }
+
+func TestCPUsageRecorderWithThresholdsAndCap(t *testing.T) {
+	recorder := newCPUsageRecorder([]float64{85, 75, 85}, 20)
+	assert.Equal(t, 20, recorder.getRecordCap())
+	for i := 0; i < 30; i++ {
+		recorder.AddRecord(86)
+	}
+	// 计数器最多加到上限20
+	assert.Equal(t, 20, recorder.GetRecordNumOfThreshold(85))
+	assert.Equal(t, 20, recorder.GetRecordNumOfThreshold(75))
+	assert.Equal(t, 20, recorder.GetRecordNumOfCounterType(CounterTypeEighty))
+	assert.Equal(t, 0, recorder.GetRecordNumOfCounterType(CounterTypeNinety))
+
+	recorder.AddRecord(80) // 85的计数器减1，75和80的计数器不变
+	assert.Equal(t, 19, recorder.GetRecordNumOfThreshold(85))
+	assert.Equal(t, 20, recorder.GetRecordNumOfThreshold(75))
+	assert.Equal(t, 20, recorder.GetRecordNumOfThreshold(80))
+	// 没有记录的阈值返回0
+	assert.Equal(t, 0, recorder.GetRecordNumOfThreshold(95))
+}
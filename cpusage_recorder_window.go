@@ -0,0 +1,123 @@
+package cpumassager
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// windowRecord 滑动窗口记录器中的一条记录
+type windowRecord struct {
+	recordTime time.Time
+	cpusage    float64
+}
+
+// SlidingWindowRecorder 滑动窗口记录器，使用环形缓冲区精确地保存最近的若干条记录，
+// 可以回答"最近N秒内CPU使用率>=X的占比"以及分位数这类问题
+type SlidingWindowRecorder struct {
+	mu      sync.Mutex
+	records []windowRecord
+	// next 下一条记录在环形缓冲区中的位置
+	next int
+	full bool
+	now  func() time.Time
+}
+
+// NewSlidingWindowRecorder 新建一个滑动窗口记录器，size是最多保存的记录数，
+// massagePlan每秒记录一次CPU使用率，例如60表示保存最近60秒的记录
+func NewSlidingWindowRecorder(size int) (*SlidingWindowRecorder, error) {
+	if size <= 0 {
+		return nil, fmt.Errorf("size should greater than 0")
+	}
+	return &SlidingWindowRecorder{
+		records: make([]windowRecord, size),
+		now:     time.Now,
+	}, nil
+}
+
+// AddRecord 添加一条CPU使用率的记录
+func (r *SlidingWindowRecorder) AddRecord(cpusage float64) {
+	if cpusage < 0 || cpusage > 100 {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.records[r.next] = windowRecord{recordTime: r.now(), cpusage: cpusage}
+	r.next = (r.next + 1) % len(r.records)
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+// recordsWithin 获取最近window时长内的记录的CPU使用率，window<=0表示获取所有的记录
+func (r *SlidingWindowRecorder) recordsWithin(window time.Duration) []float64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	num := r.next
+	if r.full {
+		num = len(r.records)
+	}
+	var since time.Time
+	if window > 0 {
+		since = r.now().Add(-window)
+	}
+	cpusages := make([]float64, 0, num)
+	for i := 1; i <= num; i++ {
+		record := r.records[(r.next-i+len(r.records))%len(r.records)]
+		if window > 0 && record.recordTime.Before(since) {
+			break
+		}
+		cpusages = append(cpusages, record.cpusage)
+	}
+	return cpusages
+}
+
+// GetLoadRatio 获取缓冲区内CPU使用率>=threshold的记录数占缓冲区大小的比例，
+// 缓冲区还没有写满的时候不会因为一两条高负荷的记录就得到很高的占比
+func (r *SlidingWindowRecorder) GetLoadRatio(threshold float64) float64 {
+	return r.GetLoadRatioWithin(threshold, 0)
+}
+
+// GetLoadRatioWithin 获取最近window时长内CPU使用率>=threshold的记录数占window时长内应有的
+// 记录数的比例，每秒一条记录，应有的记录数不超过缓冲区大小，window<=0表示整个缓冲区，
+// 记录还不够的时候不会因为一两条高负荷的记录就得到很高的占比
+func (r *SlidingWindowRecorder) GetLoadRatioWithin(threshold float64, window time.Duration) float64 {
+	cpusages := r.recordsWithin(window)
+	count := 0
+	for _, cpusage := range cpusages {
+		if cpusage >= threshold {
+			count++
+		}
+	}
+	total := len(r.records)
+	if window > 0 && int(window/time.Second) < total {
+		total = int(window / time.Second)
+	}
+	if len(cpusages) > total {
+		total = len(cpusages)
+	}
+	if total == 0 {
+		return 0
+	}
+	return float64(count) / float64(total)
+}
+
+// GetPercentile 获取最近window时长内CPU使用率的分位数，percentile取值范围是[0, 100]，
+// window<=0表示使用缓冲区内所有的记录，没有记录时返回0
+func (r *SlidingWindowRecorder) GetPercentile(percentile float64, window time.Duration) float64 {
+	cpusages := r.recordsWithin(window)
+	if len(cpusages) == 0 {
+		return 0
+	}
+	sort.Float64s(cpusages)
+	rank := int(math.Ceil(percentile/100*float64(len(cpusages)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	if rank >= len(cpusages) {
+		rank = len(cpusages) - 1
+	}
+	return cpusages[rank]
+}
@@ -0,0 +1,45 @@
+package cpumassager
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSlidingWindowRecorder(t *testing.T) {
+	assert := assert.New(t)
+	_, err := NewSlidingWindowRecorder(0)
+	assert.NotNil(err)
+
+	recorder, err := NewSlidingWindowRecorder(5)
+	require.Nil(t, err)
+	startTime := time.Now()
+	now := startTime
+	recorder.now = func() time.Time { return now }
+	assert.Equal(0.0, recorder.GetLoadRatio(80))
+	assert.Equal(0.0, recorder.GetPercentile(50, 0))
+
+	// 缓冲区还没有写满的时候按照缓冲区大小计算占比
+	recorder.AddRecord(90)
+	assert.InDelta(0.2, recorder.GetLoadRatio(80), 1e-9)
+	assert.InDelta(0.5, recorder.GetLoadRatioWithin(80, 2*time.Second), 1e-9)
+	now = now.Add(time.Second)
+
+	// 每秒一条记录，共7条，缓冲区只保留最近的5条：30, 90, 40, 95, 85
+	for _, cpusage := range []float64{99, 99, 30, 90, 40, 95, 85} {
+		recorder.AddRecord(cpusage)
+		now = now.Add(time.Second)
+	}
+	recorder.AddRecord(-1)
+	assert.InDelta(0.6, recorder.GetLoadRatio(80), 1e-9)
+	// 最近3秒内的记录：40, 95, 85
+	assert.InDelta(2.0/3, recorder.GetLoadRatioWithin(80, 3*time.Second), 1e-9)
+	assert.InDelta(1.0/3, recorder.GetLoadRatioWithin(90, 3*time.Second), 1e-9)
+
+	assert.Equal(30.0, recorder.GetPercentile(0, 0))
+	assert.Equal(85.0, recorder.GetPercentile(50, 0))
+	assert.Equal(95.0, recorder.GetPercentile(100, 0))
+	assert.Equal(85.0, recorder.GetPercentile(50, 3*time.Second))
+}
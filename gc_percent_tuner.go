@@ -0,0 +1,105 @@
+package cpumassager
+
+import (
+	"runtime"
+	"runtime/debug"
+	"time"
+)
+
+// heapAllocRefreshInterval 读取堆大小的最小间隔，runtime.ReadMemStats需要stop the world，
+// 不在每次采集CPU使用率的时候都调用
+const heapAllocRefreshInterval = 10 * time.Second
+
+// gcPercentTuner GOGC调节器，在疲累状态下在内存预算内调高GOGC，减少GC占用的CPU，
+// 回到轻松状态时恢复原来的GOGC
+type gcPercentTuner struct {
+	// tiredGCPercent 疲累状态下期望使用的GOGC
+	tiredGCPercent int
+	// memoryBudget 疲累状态下堆内存的预算，以字节为单位，下一次GC的堆目标不会超过该值
+	memoryBudget uint64
+
+	// originalGCPercent 调高之前的GOGC，tuned为true的时候才有意义
+	originalGCPercent int
+	tuned             bool
+
+	// heapAlloc 最近一次读取的堆大小，heapAllocTime是读取的时间，
+	// refreshInterval之内不重复读取
+	heapAlloc       uint64
+	heapAllocTime   time.Time
+	refreshInterval time.Duration
+
+	getHeapAlloc func() uint64
+	setGCPercent func(int) int
+	now          func() time.Time
+}
+
+func newGCPercentTuner(tiredGCPercent int, memoryBudget uint64) *gcPercentTuner {
+	return &gcPercentTuner{
+		tiredGCPercent: tiredGCPercent,
+		memoryBudget:   memoryBudget,
+		getHeapAlloc: func() uint64 {
+			var ms runtime.MemStats
+			runtime.ReadMemStats(&ms)
+			return ms.HeapAlloc
+		},
+		setGCPercent:    debug.SetGCPercent,
+		now:             time.Now,
+		refreshInterval: heapAllocRefreshInterval,
+	}
+}
+
+// getCachedHeapAlloc 获取堆大小，距离上一次读取不到refreshInterval的话使用上一次读取的值
+func (t *gcPercentTuner) getCachedHeapAlloc() uint64 {
+	now := t.now()
+	if t.heapAllocTime.IsZero() || now.Sub(t.heapAllocTime) >= t.refreshInterval {
+		t.heapAlloc = t.getHeapAlloc()
+		t.heapAllocTime = now
+	}
+	return t.heapAlloc
+}
+
+// targetGCPercent 计算当前堆大小下，不超过内存预算的GOGC
+func (t *gcPercentTuner) targetGCPercent() int {
+	heapAlloc := t.getCachedHeapAlloc()
+	if heapAlloc == 0 || heapAlloc >= t.memoryBudget {
+		return 0
+	}
+	// 堆目标 = heapAlloc * (1 + GOGC/100) <= memoryBudget
+	budgetGCPercent := (t.memoryBudget - heapAlloc) * 100 / heapAlloc
+	if budgetGCPercent < uint64(t.tiredGCPercent) {
+		return int(budgetGCPercent)
+	}
+	return t.tiredGCPercent
+}
+
+// adjust 疲累状态下每次采集CPU使用率之后调用，根据当前堆大小调整GOGC，
+// 堆增长后会相应调低GOGC，但是不会低于调高之前的GOGC
+func (t *gcPercentTuner) adjust() {
+	target := t.targetGCPercent()
+	if !t.tuned {
+		// 先关闭GC读取原来的GOGC并立即恢复，避免读取时临时设置的GOGC过低而触发GC
+		original := t.setGCPercent(-1)
+		t.setGCPercent(original)
+		if original < 0 || target <= original {
+			// GC被关闭或者原来的GOGC已经足够高，不需要调整
+			return
+		}
+		t.originalGCPercent = original
+		t.tuned = true
+		t.setGCPercent(target)
+		return
+	}
+	if target < t.originalGCPercent {
+		target = t.originalGCPercent
+	}
+	t.setGCPercent(target)
+}
+
+// restore 恢复调高之前的GOGC
+func (t *gcPercentTuner) restore() {
+	if !t.tuned {
+		return
+	}
+	t.setGCPercent(t.originalGCPercent)
+	t.tuned = false
+}
@@ -0,0 +1,149 @@
+package cpumassager
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestGCPercentTuner 新建一个不会真正修改GOGC的调节器，gcPercent模拟当前的GOGC
+func newTestGCPercentTuner(tiredGCPercent int, memoryBudget uint64,
+	heapAlloc *uint64, gcPercent *int) *gcPercentTuner {
+	t := newGCPercentTuner(tiredGCPercent, memoryBudget)
+	t.getHeapAlloc = func() uint64 { return *heapAlloc }
+	t.refreshInterval = 0
+	t.setGCPercent = func(percent int) int {
+		old := *gcPercent
+		*gcPercent = percent
+		return old
+	}
+	return t
+}
+
+func TestGCPercentTuner(t *testing.T) {
+	require := require.New(t)
+	heapAlloc := uint64(100)
+	gcPercent := 100
+	tuner := newTestGCPercentTuner(400, 1000, &heapAlloc, &gcPercent)
+
+	// 预算足够，调到期望的GOGC
+	tuner.adjust()
+	require.Equal(400, gcPercent)
+	// 堆增长之后，调低到预算允许的GOGC
+	heapAlloc = 400
+	tuner.adjust()
+	require.Equal(150, gcPercent)
+	// 预算不足时也不会低于原来的GOGC
+	heapAlloc = 900
+	tuner.adjust()
+	require.Equal(100, gcPercent)
+	tuner.restore()
+	require.Equal(100, gcPercent)
+
+	// 原来的GOGC已经足够高，不需要调整
+	heapAlloc = 100
+	gcPercent = 800
+	tuner.adjust()
+	require.Equal(800, gcPercent)
+	tuner.restore()
+	require.Equal(800, gcPercent)
+
+	// GC被关闭的情况下不需要调整
+	gcPercent = -1
+	tuner.adjust()
+	require.Equal(-1, gcPercent)
+}
+
+func TestGCPercentTunerReadOriginal(t *testing.T) {
+	require := require.New(t)
+	// 堆已经超出预算的时候读取原来的GOGC不能临时设置为0，否则会立即触发GC
+	heapAlloc := uint64(2000)
+	gcPercent := 100
+	tuner := newTestGCPercentTuner(400, 1000, &heapAlloc, &gcPercent)
+	var history []int
+	setGCPercent := tuner.setGCPercent
+	tuner.setGCPercent = func(percent int) int {
+		history = append(history, percent)
+		return setGCPercent(percent)
+	}
+	tuner.adjust()
+	require.Equal([]int{-1, 100}, history)
+	require.Equal(100, gcPercent)
+}
+
+func TestGCPercentTunerHeapAllocCache(t *testing.T) {
+	require := require.New(t)
+	heapAlloc := uint64(100)
+	gcPercent := 100
+	tuner := newTestGCPercentTuner(400, 1000, &heapAlloc, &gcPercent)
+	tuner.refreshInterval = heapAllocRefreshInterval
+	now := time.Now()
+	tuner.now = func() time.Time { return now }
+
+	tuner.adjust()
+	require.Equal(400, gcPercent)
+	// refreshInterval之内使用上一次读取的堆大小
+	heapAlloc = 400
+	tuner.adjust()
+	require.Equal(400, gcPercent)
+	now = now.Add(heapAllocRefreshInterval)
+	tuner.adjust()
+	require.Equal(150, gcPercent)
+}
+
+func TestAdaptiveGOGCInMassagePlan(t *testing.T) {
+	require := require.New(t)
+	mockCtl := gomock.NewController(t)
+	defer mockCtl.Finish()
+	mockCollector := NewMockCPUsageCollector(mockCtl)
+	mockCollector.EXPECT().GetCPUsage().Return(90.0).AnyTimes()
+
+	heapAlloc := uint64(100)
+	gcPercent := 100
+	opts := options{
+		cpusageCollector:     mockCollector,
+		highLoadLevel:        CounterTypeEighty,
+		loadStatusJudgeRatio: 0.1,
+		initialIntensity:     50,
+		stepIntensity:        1,
+	}
+	WithAdaptiveGOGC(400, 1000)(&opts)
+	require.True(opts.isValid())
+	opts.gcPercentTuner = newTestGCPercentTuner(400, 1000, &heapAlloc, &gcPercent)
+	mp := massagePlan{opts: opts, currentState: stateRelaxed{}}
+
+	for mp.isRelaxed() {
+		mp.AddACPUsageRecord()
+		if mp.isRelaxed() {
+			require.Equal(100, gcPercent)
+		}
+	}
+	require.Equal(400, gcPercent)
+	mp.SetRelaxed()
+	require.Equal(100, gcPercent)
+
+	// 疲累状态下停止的时候恢复原来的GOGC
+	stopped := massagePlan{currentState: stateRelaxed{}}
+	require.Nil(stopped.Start(opts))
+	for i := 0; i < 100 && !stopped.isGCPercentTuned(); i++ {
+		stopped.AddACPUsageRecord()
+	}
+	require.True(stopped.isGCPercentTuned())
+	require.Nil(stopped.Stop())
+	require.False(stopped.isGCPercentTuned())
+	require.Equal(100, gcPercent)
+
+	WithAdaptiveGOGC(0, 1000)(&opts)
+	require.False(opts.isValid())
+	WithAdaptiveGOGC(400, 0)(&opts)
+	require.False(opts.isValid())
+}
+
+// isGCPercentTuned 在controlMu保护下判断GOGC是否已经被调高
+func (p *massagePlan) isGCPercentTuned() bool {
+	p.controlMu.Lock()
+	defer p.controlMu.Unlock()
+	return p.opts.gcPercentTuner.tuned
+}
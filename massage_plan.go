@@ -1,7 +1,9 @@
 package cpumassager
 
 import (
+	"context"
 	"fmt"
+	"sync"
 	"sync/atomic"
 	"time"
 )
@@ -21,7 +23,14 @@ const (
 	fullIntensity           = 100
 	maxStepIntensity        = 10
 	maxCheckPeriodInSeconds = 10
-	recordSum               = 100
+	minRecordCap            = 10
+	maxRecordCap            = 3600
+
+	// maxIncreaseStepIntensity 提高按摩力度的步进上限，负荷升高时需要快速压下来
+	maxIncreaseStepIntensity = 50
+	// maxDecreaseCheckPeriodInSeconds 降低按摩力度的检查周期上限，负荷回落时可以慢慢恢复
+	maxDecreaseCheckPeriodInSeconds = 60
+	minDecreaseFactor               = 0.5
 )
 
 // massagePlan 马杀鸡计划
@@ -29,15 +38,25 @@ type massagePlan struct {
 	opts options
 
 	// isStarted 判断马杀鸡计划是否已经启动的标识字段，避免重复调用
-	isStarted       bool
-	cpusageRecorder cpusageRecorder
-	currentState    massagePlanState
+	isStarted bool
+	// stopChan 用来通知定期收集CPU使用率的routine退出，doneChan在该routine退出后关闭
+	stopChan chan struct{}
+	doneChan chan struct{}
+	// controlMu 保护收集CPU使用率之后的记录和状态扭转，使人工干预和自动控制不会同时修改状态
+	controlMu sync.Mutex
+	// override 人工干预的状态，为nil表示没有人工干预，由controlMu保护
+	override *OverrideStatus
+	// relaxedOverrideExpireTime 强制保持轻松状态的人工干预的过期时间(UnixNano)，没有则为0，
+	// 会被业务routine读取，采用了原子操作
+	relaxedOverrideExpireTime int64
+	cpusageRecorder           cpusageRecorder
+	currentState              massagePlanState
 
 	currentIntensity uint
 
 	currentCPUsageRecordTime time.Time
 	changeIntensityTime      time.Time
-	lastHighLoadCount        int
+	lastHighLoadRatio        float64
 
 	// todoTasks 待处理任务，和doneTasks配合使用在疲累状态时候，依据按摩力度
 	// 算法决定是否要做马杀鸡来拒绝服务，每次接受到请求都需要调用NeedMassage
@@ -46,6 +65,42 @@ type massagePlan struct {
 	todoTasks uint64
 	// doneTasks 已处理任务
 	doneTasks uint64
+	// priorityTodoTasks、priorityDoneTasks 按照优先级分别统计的待处理、已处理任务，
+	// 供NeedMassageWithPriority使用
+	priorityTodoTasks [maxPriorities]uint64
+	priorityDoneTasks [maxPriorities]uint64
+	// tenantTracker 按照key统计的已处理任务，tenantTodoTasks、tenantDoneTasks是全部key的
+	// 待处理、已处理任务，供NeedMassageFor使用，和NeedMassage的计数互不影响
+	tenantTracker   tenantTracker
+	tenantTodoTasks uint64
+	tenantDoneTasks uint64
+	// tenantUnderShareTodoTasks 没有超过公平份额的key的待处理任务，tenantOverShareDoneTasks
+	// 超过公平份额之后依然被处理的任务，用来为没有超过公平份额的key预留余量
+	tenantUnderShareTodoTasks uint64
+	tenantOverShareDoneTasks  uint64
+	// todoCost、doneCost 以成本统计的待处理、已处理任务，供NeedMassageWeighted使用
+	todoCost uint64
+	doneCost uint64
+	// sessionTracker 粘性会话的准入控制，供NeedMassageForSession使用，为nil则没有设定粘性会话
+	sessionTracker *sessionTracker
+	// waitQueue 等待队列，供Wait使用，为nil则没有设定等待队列
+	waitQueue *waitQueue
+	// rejecter 按照WithRejectPattern设定的方式拒绝服务，为nil则按照todoTasks、doneTasks计数
+	rejecter rejecter
+
+	// dryRun 是否处于试运行模式，为1时只统计不拒绝服务，可以在运行时切换，采用了原子操作
+	dryRun      int32
+	rejectStats RejectStats
+
+	// startTime 按摩计划的启动时间，relaxedTime、relaxedFromIntensity是最近一次回到轻松状态的
+	// 时间和之前的按摩力度，用于慢启动和回到轻松状态之后的按摩力度爬坡
+	startTime            time.Time
+	relaxedTime          time.Time
+	relaxedFromIntensity uint
+	// processingTimeEstimator 按照负荷状态估计的请求处理时长，供NeedMassageCtx使用
+	processingTimeEstimator processingTimeEstimator
+	// drain 排空的状态，存放*planDrain，会被业务routine读取，采用了原子操作
+	drain atomic.Value
 }
 
 func (p *massagePlan) Start(opts options) error {
@@ -56,49 +111,140 @@ func (p *massagePlan) Start(opts options) error {
 		return fmt.Errorf("massage plan has been started")
 	}
 	p.opts = opts
+	if len(opts.loadLevels) > 0 {
+		p.opts.strategy = newLevelStrategy(opts.loadLevels, opts.loadStatusJudgeRatio)
+	}
+	p.rejecter = newRejecter(opts.rejectPattern, opts.getRandomSeed())
+	p.sessionTracker = nil
+	if opts.stickySessionTTL > 0 {
+		p.sessionTracker = newSessionTracker(opts.stickySessionTTL, opts.maxStickySessions, opts.maxStickyShare)
+	}
+	p.waitQueue = nil
+	if opts.maxWaitQueueLength > 0 {
+		p.waitQueue = newWaitQueue(opts.waitOrder, opts.maxWaitQueueLength, opts.maxWaitTime, p.getIntensity)
+	}
+	p.SetDryRun(opts.dryRun)
+	p.setOverride(nil)
+	p.startTime = time.Now()
+	p.drain.Store((*planDrain)(nil))
+	p.cpusageRecorder = newCPUsageRecorder(opts.getWatchedThresholds(), int(opts.recordCap))
+	if watcher, ok := opts.recorder.(thresholdWatcher); ok {
+		for _, threshold := range opts.getWatchedThresholds() {
+			watcher.addThreshold(threshold)
+		}
+	}
 	p.currentIntensity = opts.initialIntensity
+	if opts.snapshotter != nil {
+		// 快照不存在、过期或者无法解析的时候按照全新启动处理，不影响服务启动
+		_ = opts.snapshotter.restore(p)
+	}
 	p.isStarted = true
-	go func() {
-		for {
-			p.AddACPUsageRecord()
-			time.Sleep(time.Duration(time.Second * 1))
+	p.stopChan = make(chan struct{})
+	p.doneChan = make(chan struct{})
+	go p.run(p.stopChan, p.doneChan)
+	return nil
+}
+
+// run 每隔1秒钟收集一次CPU使用率，直到stopChan被关闭
+func (p *massagePlan) run(stopChan <-chan struct{}, doneChan chan<- struct{}) {
+	defer close(doneChan)
+	for {
+		p.AddACPUsageRecord()
+		if p.opts.snapshotter != nil && p.opts.snapshotter.needPeriodicSave(p.currentCPUsageRecordTime) {
+			_ = p.opts.snapshotter.save(p)
+		}
+		select {
+		case <-stopChan:
+			return
+		case <-time.After(time.Second * 1):
 		}
-	}()
+	}
+}
+
+func (p *massagePlan) Stop() error {
+	if !p.isStarted {
+		return fmt.Errorf("massage plan has not been started")
+	}
+	close(p.stopChan)
+	<-p.doneChan
+	p.isStarted = false
+	// 疲累状态下停止的话恢复调高之前的GOGC，避免之后一直使用调高的GOGC
+	if p.opts.gcPercentTuner != nil {
+		p.controlMu.Lock()
+		p.opts.gcPercentTuner.restore()
+		p.controlMu.Unlock()
+	}
+	if p.opts.snapshotter != nil {
+		if err := p.opts.snapshotter.save(p); err != nil {
+			return fmt.Errorf("save snapshot error:%s", err.Error())
+		}
+	}
 	return nil
 }
 
+// getRecorder 获取massagePlan使用的CPU使用率记录器，没有设定则使用默认的计数器记录器
+func (p *massagePlan) getRecorder() Recorder {
+	if p.opts.recorder != nil {
+		return p.opts.recorder
+	}
+	return &p.cpusageRecorder
+}
+
+// getHighLoadRatio 获取CPU使用率记录器中高负荷记录所占的比例
+func (p *massagePlan) getHighLoadRatio() float64 {
+	return p.getRecorder().GetLoadRatio(p.opts.getHighLoadThreshold())
+}
+
 func (p *massagePlan) IsHighLoad() bool {
-	highLoadCount := p.cpusageRecorder.GetRecordNumOfCounterType(p.opts.highLoadLevel)
-	if highLoadCount > int(recordSum*p.opts.loadStatusJudgeRatio) {
-		return true
+	if p.opts.multiWindowDetector != nil {
+		return p.opts.multiWindowDetector.isHighLoad(p.opts.getHighLoadThreshold())
 	}
-	return false
+	return p.getHighLoadRatio() > p.opts.loadStatusJudgeRatio
 }
 
-func (p *massagePlan) IsHighLoadCountIncreased() bool {
-	curHighLoadCount := p.cpusageRecorder.GetRecordNumOfCounterType(p.opts.highLoadLevel)
-	increased := curHighLoadCount > p.lastHighLoadCount || curHighLoadCount == recordSum
-	p.lastHighLoadCount = curHighLoadCount
-	return increased
+// isHighLoadRatioIncreased 高负荷占比相比lastHighLoadRatio是否升高，已经是100%也算升高
+func (p *massagePlan) isHighLoadRatioIncreased(curHighLoadRatio float64) bool {
+	return curHighLoadRatio > p.lastHighLoadRatio || curHighLoadRatio >= 1
 }
 
+// IsChangeDurationExceedCheckPeriod 距离上次调整按摩力度是否超过了提高、降低两个检查周期中较短的一个
 func (p *massagePlan) IsChangeDurationExceedCheckPeriod() bool {
-	period := p.currentCPUsageRecordTime.Sub(p.changeIntensityTime)
-	return period > time.Second*time.Duration(p.opts.checkPeriodInSeconds)
+	checkPeriod := p.opts.getIncreaseCheckPeriod()
+	if decreaseCheckPeriod := p.opts.getDecreaseCheckPeriod(); decreaseCheckPeriod < checkPeriod {
+		checkPeriod = decreaseCheckPeriod
+	}
+	return p.isChangeDurationExceed(checkPeriod)
+}
+
+// isChangeDurationExceed 距离上次调整按摩力度是否超过了checkPeriod
+func (p *massagePlan) isChangeDurationExceed(checkPeriod time.Duration) bool {
+	return p.currentCPUsageRecordTime.Sub(p.changeIntensityTime) > checkPeriod
 }
 
 func (p *massagePlan) SetRelaxed() {
+	if p.isTired() {
+		p.relaxedTime = time.Now()
+		p.relaxedFromIntensity = p.currentIntensity
+	}
+	p.relax()
+}
+
+// relax 回到轻松状态，不记录按摩力度爬坡的状态，供人工干预使用
+func (p *massagePlan) relax() {
 	p.currentState = stateRelaxed{}
 	p.currentIntensity = p.opts.initialIntensity
 	zeroTime := time.Time{}
 	p.changeIntensityTime = zeroTime
 	p.clearWorkspace()
+	if p.opts.gcPercentTuner != nil {
+		p.opts.gcPercentTuner.restore()
+	}
 }
 
 func (p *massagePlan) SetTired() {
 	p.currentState = stateTired{}
 	p.currentIntensity = p.opts.initialIntensity
-	p.lastHighLoadCount = p.cpusageRecorder.GetRecordNumOfCounterType(p.opts.highLoadLevel)
+	p.lastHighLoadRatio = p.getHighLoadRatio()
 	p.UpdateChangeIntensityTime()
 	p.clearWorkspace()
 }
@@ -112,9 +258,21 @@ func (p *massagePlan) isTired() bool {
 }
 
 func (p *massagePlan) AddACPUsageRecord() {
-	p.cpusageRecorder.AddRecord(p.opts.cpusageCollector.GetCPUsage())
+	cpusage := p.opts.cpusageCollector.GetCPUsage()
+	p.controlMu.Lock()
+	defer p.controlMu.Unlock()
+	p.getRecorder().AddRecord(cpusage)
+	if p.opts.multiWindowDetector != nil {
+		p.opts.multiWindowDetector.AddRecord(cpusage)
+	}
 	p.updateCurTime()
-	p.currentState.AddACPUsageRecord(p)
+	// 人工干预期间只记录CPU使用率，不做状态扭转，干预结束后自动控制可以平滑地接上
+	if !p.isOverridden(p.currentCPUsageRecordTime) {
+		p.runStrategy(cpusage)
+	}
+	if p.opts.gcPercentTuner != nil && p.isTired() {
+		p.opts.gcPercentTuner.adjust()
+	}
 }
 
 func (p *massagePlan) UpdateChangeIntensityTime() {
@@ -125,12 +283,25 @@ func (p *massagePlan) updateCurTime() {
 	p.currentCPUsageRecordTime = time.Now()
 }
 
+// canLeaveTired 按摩力度降为0之后是否可以回到轻松状态，
+// 多窗口模式下需要两个窗口都不热才可以
+func (p *massagePlan) canLeaveTired() bool {
+	return p.opts.multiWindowDetector == nil || !p.IsHighLoad()
+}
+
 func (p *massagePlan) DecreaseIntensity() {
 	if p.currentIntensity == emptyIntensity {
-		p.SetRelaxed()
+		if p.canLeaveTired() {
+			p.SetRelaxed()
+		} else {
+			p.UpdateChangeIntensityTime()
+		}
 	} else {
-		if p.currentIntensity > p.opts.stepIntensity {
-			p.currentIntensity -= p.opts.stepIntensity
+		stepIntensity := p.opts.getDecreaseStepIntensity()
+		if p.opts.decreaseFactor > 0 {
+			p.currentIntensity = uint(float64(p.currentIntensity) * p.opts.decreaseFactor)
+		} else if p.currentIntensity > stepIntensity {
+			p.currentIntensity -= stepIntensity
 		} else {
 			p.currentIntensity = emptyIntensity
 		}
@@ -140,8 +311,9 @@ func (p *massagePlan) DecreaseIntensity() {
 }
 
 func (p *massagePlan) IncreaseIntensity() {
-	if p.currentIntensity+p.opts.stepIntensity < fullIntensity {
-		p.currentIntensity += p.opts.stepIntensity
+	stepIntensity := p.opts.getIncreaseStepIntensity()
+	if p.currentIntensity+stepIntensity < fullIntensity {
+		p.currentIntensity += stepIntensity
 	} else {
 		p.currentIntensity = fullIntensity
 	}
@@ -152,6 +324,23 @@ func (p *massagePlan) IncreaseIntensity() {
 func (p *massagePlan) clearWorkspace() {
 	atomic.StoreUint64(&p.todoTasks, 0)
 	atomic.StoreUint64(&p.doneTasks, 0)
+	for i := range p.priorityTodoTasks {
+		atomic.StoreUint64(&p.priorityTodoTasks[i], 0)
+		atomic.StoreUint64(&p.priorityDoneTasks[i], 0)
+	}
+	p.tenantTracker.reset()
+	atomic.StoreUint64(&p.tenantTodoTasks, 0)
+	atomic.StoreUint64(&p.tenantDoneTasks, 0)
+	atomic.StoreUint64(&p.tenantUnderShareTodoTasks, 0)
+	atomic.StoreUint64(&p.tenantOverShareDoneTasks, 0)
+	atomic.StoreUint64(&p.todoCost, 0)
+	atomic.StoreUint64(&p.doneCost, 0)
+	if p.sessionTracker != nil {
+		p.sessionTracker.reset()
+	}
+	if p.waitQueue != nil {
+		p.waitQueue.reset()
+	}
 }
 
 func (p *massagePlan) addANewTask() {
@@ -170,9 +359,12 @@ func (p *massagePlan) doneTaskNum() uint64 {
 	return atomic.LoadUint64(&p.doneTasks)
 }
 
-func (p *massagePlan) canDoWorkInTired() bool {
+func (p *massagePlan) canDoWorkInTired(intensity uint) bool {
+	if p.rejecter != nil {
+		return p.rejecter.canDoWork(intensity)
+	}
 	p.addANewTask()
-	requireTasks := p.todoTaskNum() * (fullIntensity - uint64(p.currentIntensity)) / fullIntensity
+	requireTasks := p.todoTaskNum() * (fullIntensity - uint64(intensity)) / fullIntensity
 	if p.doneTaskNum() < requireTasks {
 		p.finishATask()
 		return true
@@ -181,13 +373,30 @@ func (p *massagePlan) canDoWorkInTired() bool {
 }
 
 func (p *massagePlan) NeedMassage() bool {
-	if p.isRelaxed() {
-		return false
+	intensity := p.getIntensity()
+	return p.finishDecision(intensity, intensity > emptyIntensity && !p.canDoWorkInTired(intensity))
+}
+
+func (p *massagePlan) Acquire(ctx context.Context) (release func(), ok bool) {
+	if ctx.Err() != nil {
+		return nil, false
+	}
+	startTime := time.Now()
+	if p.opts.concurrencyLimiter == nil {
+		if p.NeedMassage() {
+			return nil, false
+		}
+		return p.timedRelease(startTime, func() {}), true
 	}
-	if p.canDoWorkInTired() {
-		return false
+	intensity := p.getIntensity()
+	release, ok = p.opts.concurrencyLimiter.acquire(intensity)
+	if p.finishDecision(intensity, !ok) {
+		return nil, false
 	}
-	return true
+	if !ok {
+		release = func() {}
+	}
+	return p.timedRelease(startTime, release), true
 }
 
 // StartMassagePlan 启动马杀鸡计划，在启动程序后立即调用
@@ -224,6 +433,12 @@ func StartMassagePlan(opts ...Option) error {
 	return planInst.Start(*options)
 }
 
+// StopMassagePlan 停止马杀鸡计划，停止之后NeedMassage会保持停止时的状态，
+// 设定了WithSnapshot的话会保存一次快照，一般在程序退出前调用
+func StopMassagePlan() error {
+	return planInst.Stop()
+}
+
 // NeedMassage 非是否需要做下马杀鸡放松一下
 // 每次收到请求都调用一下，若返回false，继续做后续处理，否则直接返回
 // func handleARequest() {
@@ -236,3 +451,161 @@ func StartMassagePlan(opts ...Option) error {
 func NeedMassage() bool {
 	return planInst.NeedMassage()
 }
+
+// NeedMassageWithPriority 和NeedMassage一样判断是否需要拒绝服务，但是会按照请求的优先级
+// 分配按摩力度：优先拒绝低优先级的请求，只有更低优先级的请求已经全部被拒绝时才会拒绝
+// PriorityCritical的请求，同一类请求需要一直使用同一个API判断
+// func handleARequest(req *Request) {
+//     if cpumassager.NeedMassageWithPriority(req.Priority) {
+//         refuse() //  拒绝服务该请求
+//         return
+//     }
+//     process() //  正常处理该请求
+// }
+func NeedMassageWithPriority(priority Priority) bool {
+	return planInst.NeedMassageWithPriority(priority)
+}
+
+// NeedMassageFor 和NeedMassage一样判断是否需要拒绝服务，但是会按照key(例如租户、调用方)
+// 公平地分配按摩力度：每个key按照权重分得公平份额，优先拒绝超过公平份额的key的请求，
+// 请求量小的key可以继续得到服务，key的权重可以使用WithTenantWeights设定
+// func handleARequest(req *Request) {
+//     if cpumassager.NeedMassageFor(req.TenantID) {
+//         refuse() //  拒绝服务该请求
+//         return
+//     }
+//     process() //  正常处理该请求
+// }
+func NeedMassageFor(key string) bool {
+	return planInst.NeedMassageFor(key)
+}
+
+// NeedMassageWeighted 和NeedMassage一样判断是否需要拒绝服务，但是以成本而不是请求数来统计，
+// 按摩力度表示需要拒绝的成本占比，成本高的请求会比成本低的请求更早被拒绝，
+// 成本可以使用CostEstimator按照路由学习得到
+// func handleARequest(req *Request) {
+//     if cpumassager.NeedMassageWeighted(estimator.Estimate(req.Route)) {
+//         refuse() //  拒绝服务该请求
+//         return
+//     }
+//     startTime := time.Now()
+//     process() //  正常处理该请求
+//     estimator.Observe(req.Route, float64(time.Since(startTime).Milliseconds()))
+// }
+func NeedMassageWeighted(cost float64) bool {
+	return planInst.NeedMassageWeighted(cost)
+}
+
+// SetDryRun 在运行时切换试运行模式，试运行模式下各种判断方式都不会拒绝服务，
+// 只统计本来需要拒绝的请求数，可以通过GetRejectStats和WithRejectHook观察
+func SetDryRun(dryRun bool) {
+	planInst.SetDryRun(dryRun)
+}
+
+// GetRejectStats 获取拒绝服务的统计，包括试运行模式下本来需要拒绝的请求数
+func GetRejectStats() RejectStats {
+	return planInst.GetRejectStats()
+}
+
+// Override 人工干预按摩计划，mode为OverrideModeTired时在ttl之内强制以intensity拒绝服务，
+// 为OverrideModeRelaxed时在ttl之内强制不拒绝服务，干预期间依然会记录CPU使用率，
+// 过期或者调用ClearOverride之后恢复自动控制，一般在处理线上事故的时候使用
+func Override(mode OverrideMode, intensity uint, ttl time.Duration) error {
+	return planInst.Override(mode, intensity, ttl)
+}
+
+// ClearOverride 取消人工干预，恢复自动控制
+func ClearOverride() {
+	planInst.ClearOverride()
+}
+
+// GetMassageStatus 获取按摩计划的当前状态，包括负荷等级、按摩力度、人工干预、拒绝服务的统计等
+func GetMassageStatus() MassageStatus {
+	return planInst.GetMassageStatus()
+}
+
+// NeedMassageCtx 和NeedMassage一样判断是否需要拒绝服务，另外ctx已经取消，或者距离ctx的截止时间
+// 已经不够处理完请求的话也会拒绝服务，避免过载时为已经超时的调用方白白干活，处理时长按照
+// 当前负荷状态分别估计，来源于ReportProcessingTime以及Acquire返回的release
+// func handleARequest(ctx context.Context) {
+//     if cpumassager.NeedMassageCtx(ctx) {
+//         refuse() //  拒绝服务该请求
+//         return
+//     }
+//     startTime := time.Now()
+//     process() //  正常处理该请求
+//     cpumassager.ReportProcessingTime(time.Since(startTime))
+// }
+func NeedMassageCtx(ctx context.Context) bool {
+	return planInst.NeedMassageCtx(ctx)
+}
+
+// ReportProcessingTime 记录一次请求的处理时长，NeedMassageCtx依据处理时长的估计值判断
+// 是否来得及在截止时间之前处理完请求
+func ReportProcessingTime(d time.Duration) {
+	planInst.ReportProcessingTime(d)
+}
+
+// Wait 和NeedMassage一样判断是否需要拒绝服务，但是需要拒绝服务的时候在等待队列中排队，按照
+// 按摩力度允许的比例放行，适用于宁可稍等也不愿失败的内部批处理等调用方，需要使用WithWaitQueue
+// 设定等待队列
+// func produceABatch(ctx context.Context) error {
+//     if err := cpumassager.Wait(ctx); err != nil {
+//         return err //  ErrWaitTimeout、ErrWaitQueueFull、ErrWaitRejected或者ctx.Err()
+//     }
+//     process() //  正常处理该批任务
+//     return nil
+// }
+func Wait(ctx context.Context) error {
+	return planInst.Wait(ctx)
+}
+
+// NeedMassageForSession 和NeedMassage一样判断是否需要拒绝服务，但是需要拒绝服务期间被放行过的
+// 会话(例如下单流程)在活跃期间会继续放行，由新的会话承担拒绝，避免中途拒绝浪费已经做完的工作，
+// 需要使用WithStickySessions设定，否则和NeedMassage一致
+// func handleARequest(req *Request) {
+//     if cpumassager.NeedMassageForSession(req.SessionID) {
+//         refuse() //  拒绝服务该请求
+//         return
+//     }
+//     process() //  正常处理该请求
+// }
+func NeedMassageForSession(sessionKey string) bool {
+	return planInst.NeedMassageForSession(sessionKey)
+}
+
+// Drain 开始排空，一般在收到SIGTERM等退出信号的时候调用，不论CPU使用率如何，按摩力度都从
+// 当前的按摩力度在duration内线性地升到100，NeedMassage等API会逐渐拒绝所有新的请求，
+// 返回的channel在按摩力度升到100的时候关闭，之后可以等待在途的请求处理完成再退出
+// func main() {
+//     ...
+//     <-sigChan //  收到退出信号
+//     <-cpumassager.Drain(10 * time.Second) //  10秒内逐渐拒绝所有新的请求
+//     server.Shutdown(ctx) //  等待在途的请求处理完成
+// }
+func Drain(duration time.Duration) <-chan struct{} {
+	return planInst.Drain(duration)
+}
+
+// CurrentLoadLevel 获取当前的负荷等级名称，轻松状态为LoadLevelRelaxed，使用WithLoadLevels
+// 设定了负荷等级则为对应等级的名称，否则疲累状态为LoadLevelTired
+func CurrentLoadLevel() string {
+	return planInst.CurrentLoadLevel()
+}
+
+// Acquire 获取一个并发名额，ok为false表示需要拒绝服务，此时release为nil；ok为true的话
+// 需要在请求处理完成后调用release，并发限制会根据请求的处理时长和在途请求数自适应调整，
+// 可以发现依赖变慢这类不体现在CPU上的过载，需要使用WithConcurrencyLimit启用，
+// 否则和NeedMassage的判断一致
+// func handleARequest(ctx context.Context) {
+//     release, ok := cpumassager.Acquire(ctx)
+//     if !ok {
+//         refuse() //  拒绝服务该请求
+//         return
+//     }
+//     defer release()
+//     process() //  正常处理该请求
+// }
+func Acquire(ctx context.Context) (release func(), ok bool) {
+	return planInst.Acquire(ctx)
+}
@@ -0,0 +1,101 @@
+package cpumassager
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	// costUnitScale 统计成本时使用的精度，成本以千分之一为单位累加到原子计数器中
+	costUnitScale = 1000
+	// maxCostRoutes CostEstimator最多记录的路由个数，超出之后新路由使用默认估计值
+	maxCostRoutes = 1024
+	// maxCostUnits 一次请求最多计入的成本单位，避免过大的成本让计数器溢出
+	maxCostUnits = 1 << 40
+)
+
+// toCostUnits 把成本换算成计数器的单位，至少为1，最多为maxCostUnits，
+// NaN和小于等于0的成本按照1计算，+Inf按照maxCostUnits计算
+func toCostUnits(cost float64) uint64 {
+	if math.IsNaN(cost) || cost*costUnitScale < 1 {
+		return 1
+	}
+	if math.IsInf(cost, 1) || cost*costUnitScale >= maxCostUnits {
+		return maxCostUnits
+	}
+	return uint64(math.Round(cost * costUnitScale))
+}
+
+// canDoWorkInTiredWeighted 疲累状态下按照成本判断是否可以处理：按照按摩力度算出需要完成的
+// 成本，已完成的成本加上本次的成本不超过需要完成的成本才处理，成本越高越容易被拒绝
+func (p *massagePlan) canDoWorkInTiredWeighted(cost float64, intensity uint) bool {
+	costUnits := toCostUnits(cost)
+	todoCost := atomic.AddUint64(&p.todoCost, costUnits)
+	requireCost := todoCost * (fullIntensity - uint64(intensity)) / fullIntensity
+	if atomic.LoadUint64(&p.doneCost)+costUnits <= requireCost {
+		atomic.AddUint64(&p.doneCost, costUnits)
+		return true
+	}
+	return false
+}
+
+// NeedMassageWeighted 和NeedMassage一样判断是否需要拒绝服务，但是以成本而不是请求数统计，
+// 按摩力度表示需要拒绝的成本占比
+func (p *massagePlan) NeedMassageWeighted(cost float64) bool {
+	intensity := p.getIntensity()
+	return p.finishDecision(intensity, intensity > emptyIntensity && !p.canDoWorkInTiredWeighted(cost, intensity))
+}
+
+// CostEstimator 按照路由学习请求成本的估计器，以指数加权移动平均的方式记录每个路由
+// 的成本(例如处理耗时的毫秒数)，用来给NeedMassageWeighted提供成本，可以并发调用
+type CostEstimator struct {
+	mu    sync.Mutex
+	alpha float64
+	costs map[string]float64
+}
+
+// NewCostEstimator 新建一个按照路由学习请求成本的估计器，alpha是指数加权移动平均的系数，
+// 取值范围是(0, 1]，越大越看重最近的成本
+func NewCostEstimator(alpha float64) (*CostEstimator, error) {
+	if alpha <= 0 || alpha > 1 {
+		return nil, fmt.Errorf("alpha should in (0, 1], 0.1 is recommended")
+	}
+	return &CostEstimator{alpha: alpha, costs: make(map[string]float64)}, nil
+}
+
+// Observe 记录一次路由请求的实际成本，非法的成本(<=0、NaN、Inf)会被忽略
+func (e *CostEstimator) Observe(route string, cost float64) {
+	if cost <= 0 || math.IsNaN(cost) || math.IsInf(cost, 0) {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	last, ok := e.costs[route]
+	if !ok {
+		if len(e.costs) >= maxCostRoutes {
+			return
+		}
+		e.costs[route] = cost
+		return
+	}
+	e.costs[route] = last*(1-e.alpha) + cost*e.alpha
+}
+
+// Estimate 获取路由的成本估计值，没有记录的路由使用所有路由的平均值，一个记录都没有则为1
+func (e *CostEstimator) Estimate(route string) float64 {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if cost, ok := e.costs[route]; ok {
+		return cost
+	}
+	if len(e.costs) == 0 {
+		return 1
+	}
+	sum := 0.0
+	for _, cost := range e.costs {
+		sum += cost
+	}
+	return sum / float64(len(e.costs))
+}
@@ -0,0 +1,81 @@
+package cpumassager
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNeedMassageWeighted(t *testing.T) {
+	require := require.New(t)
+	mp := massagePlan{
+		opts:         options{initialIntensity: 50},
+		currentState: stateRelaxed{},
+	}
+	require.False(mp.NeedMassageWeighted(100))
+
+	// 按摩力度表示需要拒绝的成本占比
+	mp.SetTired()
+	rejectedCost := 0.0
+	for i := 0; i < 100; i++ {
+		if mp.NeedMassageWeighted(2) {
+			rejectedCost += 2
+		}
+	}
+	require.Equal(100.0, rejectedCost)
+
+	// 成本高的请求比成本低的请求更早被拒绝
+	mp.currentIntensity = 20
+	mp.clearWorkspace()
+	rejected := map[float64]int{}
+	for i := 0; i < 100; i++ {
+		for _, cost := range []float64{1, 1, 1, 1, 10} {
+			if mp.NeedMassageWeighted(cost) {
+				rejected[cost]++
+			}
+		}
+	}
+	require.InDelta(280, float64(rejected[1]+10*rejected[10]), 10)
+	require.Less(rejected[1], 20)
+	require.Greater(rejected[10], 20)
+	require.Equal(uint64(1), toCostUnits(0))
+
+	// 非法的成本不会让计数器溢出
+	require.Equal(uint64(1), toCostUnits(math.NaN()))
+	require.Equal(uint64(1), toCostUnits(math.Inf(-1)))
+	require.Equal(uint64(maxCostUnits), toCostUnits(math.Inf(1)))
+	require.Equal(uint64(maxCostUnits), toCostUnits(1e300))
+	mp.clearWorkspace()
+	for i := 0; i < 10; i++ {
+		mp.NeedMassageWeighted(math.Inf(1))
+		mp.NeedMassageWeighted(math.NaN())
+	}
+	require.True(mp.todoCost < math.MaxUint64/2)
+	require.True(mp.doneCost <= mp.todoCost)
+}
+
+func TestCostEstimator(t *testing.T) {
+	require := require.New(t)
+	_, err := NewCostEstimator(0)
+	require.NotNil(err)
+
+	e, err := NewCostEstimator(0.5)
+	require.Nil(err)
+	require.Equal(1.0, e.Estimate("/search"))
+	e.Observe("/search", 10)
+	e.Observe("/search", 20)
+	e.Observe("/search", -1)
+	e.Observe("/search", math.NaN())
+	e.Observe("/search", math.Inf(1))
+	e.Observe("/nan", math.NaN())
+	require.Equal(15.0, e.Estimate("/search"))
+	e.Observe("/lookup", 1)
+	require.Equal(8.0, e.Estimate("/unknown"))
+
+	for i := 0; i < maxCostRoutes; i++ {
+		e.Observe(fmt.Sprintf("/route-%d", i), 1)
+	}
+	require.Equal(maxCostRoutes, len(e.costs))
+}
@@ -0,0 +1,84 @@
+package cpumassager
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// processingTimeAlpha 处理时长指数加权移动平均的系数
+const processingTimeAlpha = 0.1
+
+// processingTimeEstimator 按照轻松、疲累两种状态分别估计请求的处理时长，零值可以直接使用
+type processingTimeEstimator struct {
+	mu sync.Mutex
+	// estimates 处理时长的指数加权移动平均，下标0是轻松状态，1是疲累状态，为0表示还没有记录
+	estimates [2]time.Duration
+}
+
+// stateIndex 获取状态在estimates中的下标
+func (e *processingTimeEstimator) stateIndex(tired bool) int {
+	if tired {
+		return 1
+	}
+	return 0
+}
+
+// report 记录一次请求的处理时长
+func (e *processingTimeEstimator) report(d time.Duration, tired bool) {
+	if d <= 0 {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	index := e.stateIndex(tired)
+	if e.estimates[index] == 0 {
+		e.estimates[index] = d
+		return
+	}
+	e.estimates[index] = time.Duration(float64(e.estimates[index])*(1-processingTimeAlpha) + float64(d)*processingTimeAlpha)
+}
+
+// estimate 获取处理时长的估计值，疲累状态还没有记录的话使用轻松状态的估计值，都没有记录则为0
+func (e *processingTimeEstimator) estimate(tired bool) time.Duration {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if estimate := e.estimates[e.stateIndex(tired)]; estimate > 0 {
+		return estimate
+	}
+	return e.estimates[0]
+}
+
+// ReportProcessingTime 记录一次请求的处理时长，用来估计当前负荷状态下的处理时长
+func (p *massagePlan) ReportProcessingTime(d time.Duration) {
+	p.processingTimeEstimator.report(d, p.isTired())
+}
+
+// timedRelease 包装release，调用时记录从startTime开始的处理时长，多次调用只生效一次
+func (p *massagePlan) timedRelease(startTime time.Time, release func()) func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			p.ReportProcessingTime(time.Since(startTime))
+			release()
+		})
+	}
+}
+
+// isDeadlineTooClose 距离ctx的截止时间是否已经不够处理一个请求
+func (p *massagePlan) isDeadlineTooClose(ctx context.Context) bool {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return false
+	}
+	return time.Until(deadline) < p.processingTimeEstimator.estimate(p.isTired())
+}
+
+// NeedMassageCtx 和NeedMassage一样判断是否需要拒绝服务，另外ctx已经取消，或者距离ctx的
+// 截止时间已经不够按照当前负荷状态下估计的处理时长处理完请求的话，也需要拒绝服务
+func (p *massagePlan) NeedMassageCtx(ctx context.Context) bool {
+	if ctx.Err() != nil || p.isDeadlineTooClose(ctx) {
+		return p.finishDecision(p.getIntensity(), true)
+	}
+	return p.NeedMassage()
+}
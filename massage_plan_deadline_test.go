@@ -0,0 +1,63 @@
+package cpumassager
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestProcessingTimeEstimator(t *testing.T) {
+	require := require.New(t)
+	var e processingTimeEstimator
+	require.Equal(time.Duration(0), e.estimate(false))
+	e.report(100*time.Millisecond, false)
+	e.report(0, false)
+	require.Equal(100*time.Millisecond, e.estimate(false))
+	// 疲累状态还没有记录的时候使用轻松状态的估计值
+	require.Equal(100*time.Millisecond, e.estimate(true))
+	e.report(500*time.Millisecond, true)
+	e.report(1500*time.Millisecond, true)
+	require.Equal(600*time.Millisecond, e.estimate(true))
+	e.report(200*time.Millisecond, false)
+	require.Equal(110*time.Millisecond, e.estimate(false))
+}
+
+func TestNeedMassageCtx(t *testing.T) {
+	require := require.New(t)
+	mp := massagePlan{
+		opts: options{
+			cpusageCollector:     collectorFunc(func() float64 { return 0 }),
+			loadStatusJudgeRatio: 0.2,
+			initialIntensity:     50,
+		},
+		currentState: stateRelaxed{},
+	}
+	require.False(mp.NeedMassageCtx(context.Background()))
+
+	// 已经取消的请求直接拒绝
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	require.True(mp.NeedMassageCtx(ctx))
+
+	// 距离截止时间不够处理完请求的时候拒绝，处理时长按照负荷状态分别估计
+	mp.ReportProcessingTime(10 * time.Millisecond)
+	ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	require.False(mp.NeedMassageCtx(ctx))
+	mp.SetTired()
+	mp.ReportProcessingTime(2 * time.Second)
+	require.True(mp.NeedMassageCtx(ctx))
+	mp.SetRelaxed()
+	require.False(mp.NeedMassageCtx(ctx))
+
+	// Acquire返回的release也会记录处理时长
+	release, ok := mp.Acquire(context.Background())
+	require.True(ok)
+	time.Sleep(20 * time.Millisecond)
+	release()
+	release()
+	require.True(mp.processingTimeEstimator.estimate(false) > 10*time.Millisecond)
+	require.Equal(RejectStats{Requests: 2, Rejected: 2}, mp.GetRejectStats())
+}
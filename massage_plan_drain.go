@@ -0,0 +1,58 @@
+package cpumassager
+
+import (
+	"math"
+	"time"
+)
+
+// planDrain 排空的状态，按摩力度从开始排空时的按摩力度在duration内线性升到100
+type planDrain struct {
+	startTime     time.Time
+	duration      time.Duration
+	fromIntensity uint
+	doneChan      chan struct{}
+}
+
+// getDrain 获取排空的状态，没有在排空则为nil
+func (p *massagePlan) getDrain() *planDrain {
+	drain, _ := p.drain.Load().(*planDrain)
+	return drain
+}
+
+// getDrainIntensity 获取排空在now时刻的按摩力度，没有在排空则为0
+func (p *massagePlan) getDrainIntensity(now time.Time) uint {
+	drain := p.getDrain()
+	if drain == nil {
+		return emptyIntensity
+	}
+	elapsed := now.Sub(drain.startTime)
+	if elapsed >= drain.duration {
+		return fullIntensity
+	}
+	progress := math.Max(0, float64(elapsed)/float64(drain.duration))
+	return drain.fromIntensity + uint(math.Round(float64(fullIntensity-drain.fromIntensity)*progress))
+}
+
+// Drain 开始排空，不论CPU使用率如何，按摩力度都从当前实际生效的按摩力度在duration内线性地
+// 升到100，返回的channel在按摩力度升到100的时候关闭，已经在排空的话返回之前的channel
+func (p *massagePlan) Drain(duration time.Duration) <-chan struct{} {
+	p.controlMu.Lock()
+	defer p.controlMu.Unlock()
+	if drain := p.getDrain(); drain != nil {
+		return drain.doneChan
+	}
+	if duration < 0 {
+		duration = 0
+	}
+	drain := &planDrain{
+		startTime:     time.Now(),
+		duration:      duration,
+		fromIntensity: p.getIntensity(),
+		doneChan:      make(chan struct{}),
+	}
+	p.drain.Store(drain)
+	time.AfterFunc(duration, func() {
+		close(drain.doneChan)
+	})
+	return drain.doneChan
+}
@@ -0,0 +1,51 @@
+package cpumassager
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMassagePlanDrain(t *testing.T) {
+	require := require.New(t)
+	mp := massagePlan{
+		opts:         options{initialIntensity: 40},
+		currentState: stateRelaxed{},
+	}
+	require.Equal(uint(emptyIntensity), mp.getDrainIntensity(time.Now()))
+	require.False(mp.GetMassageStatus().Draining)
+	mp.SetTired()
+
+	// 按摩力度从当前的按摩力度线性升到100，和CPU状态无关
+	doneChan := mp.Drain(50 * time.Millisecond)
+	require.Equal(doneChan, mp.Drain(time.Hour))
+	drain := mp.getDrain()
+	require.Equal(uint(40), drain.fromIntensity)
+	require.Equal(uint(70), mp.getDrainIntensity(drain.startTime.Add(25*time.Millisecond)))
+	require.Equal(uint(fullIntensity), mp.getDrainIntensity(drain.startTime.Add(50*time.Millisecond)))
+	mp.SetRelaxed()
+	require.GreaterOrEqual(mp.getIntensity(), uint(40))
+	require.True(mp.GetMassageStatus().Draining)
+
+	select {
+	case <-doneChan:
+	case <-time.After(time.Second):
+		require.Fail("drain not done")
+	}
+	require.Equal(uint(fullIntensity), mp.getIntensity())
+	for i := 0; i < 10; i++ {
+		require.True(mp.NeedMassage())
+	}
+}
+
+func TestMassagePlanDrainImmediately(t *testing.T) {
+	require := require.New(t)
+	mp := massagePlan{currentState: stateRelaxed{}}
+	select {
+	case <-mp.Drain(-time.Second):
+	case <-time.After(time.Second):
+		require.Fail("drain not done")
+	}
+	require.True(mp.NeedMassage())
+}
@@ -0,0 +1,64 @@
+package cpumassager
+
+import "sync/atomic"
+
+// RejectStats 拒绝服务的统计，从按摩计划启动开始累计
+type RejectStats struct {
+	// Requests 判断过是否需要拒绝服务的请求数，为了不在轻松的时候给每个请求增加原子操作的开销，
+	// 按摩力度为0并且不需要拒绝的请求不统计
+	Requests uint64
+	// Rejected 实际拒绝服务的请求数
+	Rejected uint64
+	// WouldRejected 试运行模式下本来需要拒绝、实际没有拒绝的请求数
+	WouldRejected uint64
+}
+
+// RejectHook 每次判断需要拒绝服务的时候调用，dryRun为true表示处于试运行模式，请求并没有
+// 被真正拒绝，会在业务routine中同步调用，需要尽快返回
+type RejectHook func(dryRun bool)
+
+// isDryRun 是否处于试运行模式
+func (p *massagePlan) isDryRun() bool {
+	return atomic.LoadInt32(&p.dryRun) == 1
+}
+
+// SetDryRun 在运行时切换试运行模式和正式拒绝服务的模式
+func (p *massagePlan) SetDryRun(dryRun bool) {
+	var value int32
+	if dryRun {
+		value = 1
+	}
+	atomic.StoreInt32(&p.dryRun, value)
+}
+
+// finishDecision 统计是否需要拒绝服务的判断结果并调用钩子，返回实际是否拒绝服务，
+// 试运行模式下总是返回false，各种判断方式都需要经过这里，intensity是判断时实际生效的
+// 按摩力度，为0并且不需要拒绝的时候直接返回，不做任何统计
+func (p *massagePlan) finishDecision(intensity uint, reject bool) bool {
+	if !reject && intensity == emptyIntensity {
+		return false
+	}
+	atomic.AddUint64(&p.rejectStats.Requests, 1)
+	if !reject {
+		return false
+	}
+	dryRun := p.isDryRun()
+	if dryRun {
+		atomic.AddUint64(&p.rejectStats.WouldRejected, 1)
+	} else {
+		atomic.AddUint64(&p.rejectStats.Rejected, 1)
+	}
+	if p.opts.rejectHook != nil {
+		p.opts.rejectHook(dryRun)
+	}
+	return !dryRun
+}
+
+// GetRejectStats 获取拒绝服务的统计
+func (p *massagePlan) GetRejectStats() RejectStats {
+	return RejectStats{
+		Requests:      atomic.LoadUint64(&p.rejectStats.Requests),
+		Rejected:      atomic.LoadUint64(&p.rejectStats.Rejected),
+		WouldRejected: atomic.LoadUint64(&p.rejectStats.WouldRejected),
+	}
+}
@@ -0,0 +1,57 @@
+package cpumassager
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMassagePlanDryRun(t *testing.T) {
+	require := require.New(t)
+	var hookCalls, dryRunHookCalls int
+	mp := massagePlan{
+		opts: options{
+			cpusageCollector:     collectorFunc(func() float64 { return 0 }),
+			loadStatusJudgeRatio: 0.2,
+			initialIntensity:     fullIntensity,
+		},
+		currentState: stateRelaxed{},
+	}
+	WithDryRun(true)(&mp.opts)
+	WithRejectHook(func(dryRun bool) {
+		hookCalls++
+		if dryRun {
+			dryRunHookCalls++
+		}
+	})(&mp.opts)
+	require.True(mp.opts.isValid())
+	mp.SetDryRun(mp.opts.dryRun)
+	require.True(mp.isDryRun())
+
+	// 试运行模式下各种判断方式都不拒绝服务，只统计本来需要拒绝的请求
+	require.False(mp.NeedMassage())
+	mp.SetTired()
+	require.False(mp.NeedMassage())
+	require.False(mp.NeedMassageWithPriority(PriorityBatch))
+	require.False(mp.NeedMassageFor("tenant"))
+	require.False(mp.NeedMassageWeighted(1))
+	// 按摩力度为0并且不需要拒绝的请求不统计
+	require.Equal(RejectStats{Requests: 4, WouldRejected: 4}, mp.GetRejectStats())
+	require.Equal(4, dryRunHookCalls)
+
+	WithConcurrencyLimit(NewVegasLimit(), 1, 1, 1)(&mp.opts)
+	release, ok := mp.Acquire(context.Background())
+	require.True(ok)
+	release()
+
+	// 运行时切换到正式拒绝服务的模式
+	mp.SetDryRun(false)
+	require.False(mp.isDryRun())
+	require.True(mp.NeedMassage())
+	_, ok = mp.Acquire(context.Background())
+	require.False(ok)
+	require.Equal(RejectStats{Requests: 7, Rejected: 2, WouldRejected: 5}, mp.GetRejectStats())
+	require.Equal(7, hookCalls)
+	require.Equal(5, dryRunHookCalls)
+}
@@ -0,0 +1,128 @@
+package cpumassager
+
+import (
+	"fmt"
+	"math"
+	"sync/atomic"
+)
+
+const (
+	// LoadLevelRelaxed 轻松状态对应的负荷等级名称
+	LoadLevelRelaxed = "relaxed"
+	// LoadLevelTired 没有设定WithLoadLevels时疲累状态对应的负荷等级名称
+	LoadLevelTired = "tired"
+
+	maxLoadLevels = 8
+)
+
+// LoadLevel 负荷等级，在轻松和疲累两种状态之外细分出多个等级，每个等级有各自的
+// 进入、退出阈值和按摩力度范围，例如轻度拒绝的warm和几乎全部拒绝的exhausted
+type LoadLevel struct {
+	// Name 负荷等级的名称，通过CurrentLoadLevel查询
+	Name string
+	// EnterThreshold 进入阈值，最近一段时间CPU使用率>=该值的记录占比超过
+	// loadStatusJudgeRatio就进入该等级
+	EnterThreshold float64
+	// ExitThreshold 退出阈值，需要小于EnterThreshold，CPU使用率>=该值的记录占比
+	// 不再超过loadStatusJudgeRatio就退回到低一级
+	ExitThreshold float64
+	// MinIntensity、MaxIntensity 该等级的按摩力度范围，刚进入该等级时使用MinIntensity，
+	// CPU使用率>=EnterThreshold的记录占比越高，按摩力度越接近MaxIntensity
+	MinIntensity uint
+	MaxIntensity uint
+}
+
+// DefaultLoadLevels 推荐的负荷等级：warm轻度拒绝，tired中度拒绝，
+// exhausted在CPU使用率持续高于95%的时候几乎全部拒绝
+func DefaultLoadLevels() []LoadLevel {
+	return []LoadLevel{
+		{Name: "warm", EnterThreshold: 70, ExitThreshold: 60, MinIntensity: 5, MaxIntensity: 20},
+		{Name: "tired", EnterThreshold: 80, ExitThreshold: 70, MinIntensity: 20, MaxIntensity: 80},
+		{Name: "exhausted", EnterThreshold: 95, ExitThreshold: 90, MinIntensity: 90, MaxIntensity: 100},
+	}
+}
+
+// isValidLoadLevels 用来判断负荷等级是否合法，等级需要按照EnterThreshold从低到高排列
+func isValidLoadLevels(levels []LoadLevel) error {
+	if len(levels) > maxLoadLevels {
+		return fmt.Errorf("load levels should not more than %d", maxLoadLevels)
+	}
+	for i, l := range levels {
+		if l.Name == "" || l.Name == LoadLevelRelaxed {
+			return fmt.Errorf("name of load level %d should not be empty or %s", i, LoadLevelRelaxed)
+		}
+		if l.EnterThreshold <= 0 || l.EnterThreshold > 100 {
+			return fmt.Errorf("enterThreshold of load level %s should in (0, 100]", l.Name)
+		}
+		if l.ExitThreshold < 0 || l.ExitThreshold >= l.EnterThreshold {
+			return fmt.Errorf("exitThreshold of load level %s should in [0, enterThreshold)", l.Name)
+		}
+		if l.MinIntensity == emptyIntensity || l.MinIntensity > l.MaxIntensity || l.MaxIntensity > fullIntensity {
+			return fmt.Errorf("intensity of load level %s should satisfy 0 < min <= max <= %d", l.Name, fullIntensity)
+		}
+		if i > 0 && l.EnterThreshold <= levels[i-1].EnterThreshold {
+			return fmt.Errorf("load levels should be sorted by enterThreshold ascending")
+		}
+	}
+	return nil
+}
+
+// levelStrategy 分级负荷的控制策略，按照各个负荷等级的进入、退出阈值切换等级，
+// 并在等级的按摩力度范围内按照高负荷记录的占比设定按摩力度
+type levelStrategy struct {
+	levels     []LoadLevel
+	judgeRatio float64
+	// current 当前负荷等级在levels中的下标，-1表示轻松，会被业务routine读取，采用原子操作
+	current int32
+}
+
+func newLevelStrategy(levels []LoadLevel, judgeRatio float64) *levelStrategy {
+	return &levelStrategy{levels: levels, judgeRatio: judgeRatio, current: -1}
+}
+
+// currentLevel 获取当前负荷等级的名称
+func (s *levelStrategy) currentLevel() string {
+	current := atomic.LoadInt32(&s.current)
+	if current < 0 {
+		return LoadLevelRelaxed
+	}
+	return s.levels[current].Name
+}
+
+func (s *levelStrategy) NextIntensity(cpusage float64, ctx StrategyContext) uint {
+	recorder := ctx.Recorder()
+	current := int(atomic.LoadInt32(&s.current))
+	// 负荷升高时直接进入满足条件的最高等级，负荷降低时每次只退回一级
+	escalated := false
+	for i := len(s.levels) - 1; i > current; i-- {
+		if recorder.GetLoadRatio(s.levels[i].EnterThreshold) > s.judgeRatio {
+			current = i
+			escalated = true
+			break
+		}
+	}
+	if !escalated && current >= 0 && recorder.GetLoadRatio(s.levels[current].ExitThreshold) <= s.judgeRatio {
+		current--
+	}
+	atomic.StoreInt32(&s.current, int32(current))
+	if current < 0 {
+		return emptyIntensity
+	}
+
+	level := s.levels[current]
+	ratio := recorder.GetLoadRatio(level.EnterThreshold)
+	fraction := math.Max(0, math.Min(1, (ratio-s.judgeRatio)/(1-s.judgeRatio)))
+	return level.MinIntensity + uint(math.Round(float64(level.MaxIntensity-level.MinIntensity)*fraction))
+}
+
+// CurrentLoadLevel 获取当前的负荷等级名称，轻松状态返回LoadLevelRelaxed，设定了
+// WithLoadLevels则返回对应LoadLevel的Name，否则疲累状态返回LoadLevelTired
+func (p *massagePlan) CurrentLoadLevel() string {
+	if s, ok := p.opts.strategy.(*levelStrategy); ok {
+		return s.currentLevel()
+	}
+	if p.isRelaxed() {
+		return LoadLevelRelaxed
+	}
+	return LoadLevelTired
+}
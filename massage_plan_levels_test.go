@@ -0,0 +1,94 @@
+package cpumassager
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsValidLoadLevels(t *testing.T) {
+	require := require.New(t)
+	require.Nil(isValidLoadLevels(DefaultLoadLevels()))
+
+	levels := DefaultLoadLevels()
+	levels[0].Name = LoadLevelRelaxed
+	require.NotNil(isValidLoadLevels(levels))
+	levels = DefaultLoadLevels()
+	levels[1].ExitThreshold = 80
+	require.NotNil(isValidLoadLevels(levels))
+	levels = DefaultLoadLevels()
+	levels[2].EnterThreshold = 101
+	require.NotNil(isValidLoadLevels(levels))
+	levels = DefaultLoadLevels()
+	levels[0].MinIntensity = 0
+	require.NotNil(isValidLoadLevels(levels))
+	levels = DefaultLoadLevels()
+	levels[1].MinIntensity = 90
+	require.NotNil(isValidLoadLevels(levels))
+	levels = DefaultLoadLevels()
+	levels[0], levels[1] = levels[1], levels[0]
+	require.NotNil(isValidLoadLevels(levels))
+	require.NotNil(isValidLoadLevels(make([]LoadLevel, maxLoadLevels+1)))
+}
+
+func TestMassagePlanWithLoadLevels(t *testing.T) {
+	require := require.New(t)
+	cpusage := 0.0
+	mp := massagePlan{
+		opts: options{
+			cpusageCollector:     collectorFunc(func() float64 { return cpusage }),
+			loadStatusJudgeRatio: 0.2,
+			initialIntensity:     50,
+			recorder:             NewCounterRecorder(10, 95),
+		},
+		currentState: stateRelaxed{},
+	}
+	WithLoadLevels(DefaultLoadLevels()...)(&mp.opts)
+	require.True(mp.opts.isValid())
+	mp.opts.strategy = newLevelStrategy(mp.opts.loadLevels, mp.opts.loadStatusJudgeRatio)
+	require.Equal(LoadLevelRelaxed, mp.CurrentLoadLevel())
+	addRecordsUntilLevelChanged := func(usage float64) {
+		cpusage = usage
+		level := mp.CurrentLoadLevel()
+		for i := 0; i < 20 && mp.CurrentLoadLevel() == level; i++ {
+			mp.AddACPUsageRecord()
+		}
+	}
+
+	// 负荷不太高的时候只进入warm，轻度拒绝
+	addRecordsUntilLevelChanged(75)
+	require.Equal("warm", mp.CurrentLoadLevel())
+	require.True(mp.isTired())
+	require.Equal(uint(7), mp.currentIntensity)
+
+	// CPU使用率持续高于95%直接进入exhausted，按摩力度随高负荷占比升高到100
+	addRecordsUntilLevelChanged(100)
+	require.Equal("exhausted", mp.CurrentLoadLevel())
+	require.Equal(uint(91), mp.currentIntensity)
+	for i := 0; i < 10; i++ {
+		mp.AddACPUsageRecord()
+	}
+	require.Equal(uint(fullIntensity), mp.currentIntensity)
+
+	// 负荷降低时逐级退回
+	addRecordsUntilLevelChanged(85)
+	require.Equal("tired", mp.CurrentLoadLevel())
+	require.Equal(uint(80), mp.currentIntensity)
+	addRecordsUntilLevelChanged(65)
+	require.Equal("warm", mp.CurrentLoadLevel())
+	addRecordsUntilLevelChanged(50)
+	require.Equal(LoadLevelRelaxed, mp.CurrentLoadLevel())
+	require.True(mp.isRelaxed())
+	require.False(mp.NeedMassage())
+
+	WithStrategy(&scriptedStrategy{})(&mp.opts)
+	require.False(mp.opts.isValid())
+}
+
+func TestCurrentLoadLevelWithoutLevels(t *testing.T) {
+	require := require.New(t)
+	mp := massagePlan{currentState: stateRelaxed{}}
+	require.Equal(LoadLevelRelaxed, mp.CurrentLoadLevel())
+	mp.SetTired()
+	require.Equal(LoadLevelTired, mp.CurrentLoadLevel())
+}
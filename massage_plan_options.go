@@ -1,6 +1,9 @@
 package cpumassager
 
-import "fmt"
+import (
+	"fmt"
+	"time"
+)
 
 type options struct {
 	cpusageCollector CPUsageCollector
@@ -11,13 +14,26 @@ type options struct {
 	// 率>=70就认为当前CPU高负荷了
 	// highLoadLevel需要和loadStatusJudgeRatio配合使用，单次的CPU使用率
 	// 超过所配置的highLoadLevel有可能是毛刺，cpusageRecorder会每隔一
-	// 秒钟记录一次CPU使用率，最多纪录100次，如果100次记录中超过所配置
-	// 的highLoadLevel的数量>=100*loadStatusJudgeRatio，则认为CPU当前在
+	// 秒钟记录一次CPU使用率，最多纪录recordCap次(默认100次)，如果记录中超过所配置
+	// 的highLoadLevel的数量>recordCap*loadStatusJudgeRatio，则认为CPU当前在
 	// 疲累状态需要根据按摩力度算法按一定比例拒绝请求（做下马杀鸡）
 	highLoadLevel CounterType
+	// highLoadThreshold 高负荷阈值，可以是[0, 100]之间的任意CPU使用率，例如85表示
+	// CPU使用率>=85就认为当前CPU高负荷了，为0时使用highLoadLevel对应的阈值
+	highLoadThreshold float64
 	// loadStatusJudgeRatio 负荷状态判别比例
 	loadStatusJudgeRatio float64
 
+	// multiWindowDetector 多窗口负荷检测器，为nil时只依据记录器的读数判断高负荷
+	multiWindowDetector *multiWindowDetector
+
+	// recorder CPU使用率记录器，为nil时使用以recordThresholds和recordCap构建的计数器记录器
+	recorder Recorder
+	// recordThresholds cpusageRecorder除了CounterType对应的阈值之外额外记录的阈值
+	recordThresholds []float64
+	// recordCap cpusageRecorder计数器的上限，也就是观察窗口包含的采集次数，为0时使用100
+	recordCap uint
+
 	// initialIntensity 和stepIntensity、currentIntensity、checkPeriodInSeconds
 	// 配合使用，intensity 表示按摩力度，是一个[0, 100]的数值，代表以多大比例拒
 	// 绝服务，initialIntensity是初始按摩力度，表示CPU刚进入疲累状态时候拒绝服务
@@ -27,6 +43,73 @@ type options struct {
 	initialIntensity     uint // 推荐50，发生过载就以50%的概率拒绝服务，快降
 	stepIntensity        uint // 推荐5，以5%的幅度升降拒绝服务的概率，慢调
 	checkPeriodInSeconds uint
+
+	// increaseStepIntensity、decreaseStepIntensity 分别是提高、降低按摩力度的步进值，
+	// 为0时使用stepIntensity，负荷升高时可以大步提高按摩力度，回落时再小步降低，避免反复过载
+	increaseStepIntensity uint
+	decreaseStepIntensity uint
+	// increaseCheckPeriodInSeconds、decreaseCheckPeriodInSeconds 分别是提高、降低按摩力度的
+	// 检查周期，为0时使用checkPeriodInSeconds
+	increaseCheckPeriodInSeconds uint
+	decreaseCheckPeriodInSeconds uint
+	// decreaseFactor 乘性降低按摩力度的系数，在[0.5, 1)之间时每次降低都把按摩力度乘以该系数，
+	// 为0时按照decreaseStepIntensity步进降低
+	decreaseFactor float64
+
+	// strategy 控制策略，为nil则使用DefaultStrategy，也就是依据上面的各个参数
+	// 在疲累时以stepIntensity步进调整按摩力度的轻松/疲累状态机
+	strategy Strategy
+
+	// loadLevels 负荷等级，不为空则在轻松状态之外细分出多个等级，按照各个等级的阈值和
+	// 按摩力度范围拒绝服务，替换默认的轻松/疲累状态机，不能和strategy同时设定
+	loadLevels []LoadLevel
+
+	// rejectPattern 疲累状态下NeedMassage拒绝服务的方式，默认为RejectPatternCounter
+	rejectPattern RejectPattern
+	// randomSeed RejectPatternBernoulli使用的随机数种子，为0则使用启动时间
+	randomSeed int64
+
+	// warmUpPeriod 慢启动的预热时间，启动之后的预热期内不论CPU使用率如何，放行的请求比例都从
+	// warmUpInitialAdmitRatio线性增加到1，让缓存、连接池等有时间预热，为0则不慢启动
+	warmUpPeriod            time.Duration
+	warmUpInitialAdmitRatio float64
+	// relaxedRampPeriod 回到轻松状态之后的按摩力度爬坡时间，按摩力度从回到轻松状态前的
+	// 按摩力度线性降到0，而不是立即放行全部请求，为0则不爬坡
+	relaxedRampPeriod time.Duration
+
+	// stickySessionTTL 粘性会话的活跃时间，需要拒绝服务期间被放行过的会话在最近一次放行之后
+	// 的stickySessionTTL之内继续放行，为0则不启用粘性会话
+	stickySessionTTL time.Duration
+	// maxStickySessions 粘性会话表最多记录的会话个数
+	maxStickySessions int
+	// maxStickyShare 因为粘性而放行的请求数最多占按摩力度允许放行的请求数的比例
+	maxStickyShare float64
+
+	// waitOrder、maxWaitQueueLength、maxWaitTime Wait的等待队列的放行顺序、最大长度和最长
+	// 等待时间，maxWaitQueueLength为0则不启用等待队列
+	waitOrder          WaitOrder
+	maxWaitQueueLength int
+	maxWaitTime        time.Duration
+
+	// dryRun 试运行模式，完整地运行状态机和判断逻辑，但是从不拒绝服务，
+	// 只统计本来需要拒绝的请求数，用来在正式启用之前观察按摩器的效果
+	dryRun bool
+	// rejectHook 每次判断需要拒绝服务的时候调用的钩子，为nil则不调用
+	rejectHook RejectHook
+
+	// tenantWeights NeedMassageFor中各个key的权重，没有设定的key权重为1，
+	// 权重为2的key可以得到两倍的公平份额，例如给付费用户更高的权重
+	tenantWeights map[string]float64
+
+	// concurrencyLimiter 自适应并发限制器，为nil则Acquire退化为NeedMassage
+	concurrencyLimiter *concurrencyLimiter
+
+	// snapshotter 状态快照的保存和恢复，为nil则不保存快照
+	snapshotter *planSnapshotter
+
+	// gcPercentTuner 疲累状态下在内存预算内调高GOGC的调节器，为nil则不调节，
+	// 过载时GC往往占用了不少CPU，调高GOGC可以腾出CPU从而少拒绝一些请求
+	gcPercentTuner *gcPercentTuner
 }
 
 // isValid 用来判断options中的各个选项参数是否合法
@@ -34,6 +117,17 @@ func (o *options) isValid() (bool, error) {
 	if o.cpusageCollector == nil {
 		return false, fmt.Errorf("cpusageCollector should not be nil")
 	}
+	if o.highLoadThreshold < 0 || o.highLoadThreshold > 100 {
+		return false, fmt.Errorf("highLoadThreshold should in [0, 100], 80 is recommended")
+	}
+	for _, threshold := range o.recordThresholds {
+		if threshold < 0 || threshold > 100 {
+			return false, fmt.Errorf("recordThresholds should in [0, 100], %f is invalid", threshold)
+		}
+	}
+	if o.recordCap != 0 && (o.recordCap < minRecordCap || o.recordCap > maxRecordCap) {
+		return false, fmt.Errorf("recordCap should in [%d, %d], 100 is recommended", minRecordCap, maxRecordCap)
+	}
 	if o.loadStatusJudgeRatio > 1.0 || o.loadStatusJudgeRatio < 0.1 {
 		return false, fmt.Errorf("loadStatusJudgeRatio should in [0.1, 1.0], 0.2 is recommended(means cpu can enter tired in 20 seconds)")
 	}
@@ -47,9 +141,168 @@ func (o *options) isValid() (bool, error) {
 	if o.checkPeriodInSeconds > maxCheckPeriodInSeconds {
 		return false, fmt.Errorf("checkPeriodInSeconds should not greater than:%d, 3 is recommended", maxCheckPeriodInSeconds)
 	}
+	if o.increaseStepIntensity > maxIncreaseStepIntensity {
+		return false, fmt.Errorf("increaseStepIntensity should not greater than:%d", maxIncreaseStepIntensity)
+	}
+	if o.decreaseStepIntensity > maxStepIntensity {
+		return false, fmt.Errorf("decreaseStepIntensity should not greater than:%d", maxStepIntensity)
+	}
+	if o.increaseCheckPeriodInSeconds > maxCheckPeriodInSeconds {
+		return false, fmt.Errorf("increaseCheckPeriodInSeconds should not greater than:%d", maxCheckPeriodInSeconds)
+	}
+	if o.decreaseCheckPeriodInSeconds > maxDecreaseCheckPeriodInSeconds {
+		return false, fmt.Errorf("decreaseCheckPeriodInSeconds should not greater than:%d",
+			maxDecreaseCheckPeriodInSeconds)
+	}
+	if o.decreaseFactor != 0 && (o.decreaseFactor < minDecreaseFactor || o.decreaseFactor >= 1) {
+		return false, fmt.Errorf("decreaseFactor should in [%.1f, 1), 0.9 is recommended", minDecreaseFactor)
+	}
+	if o.multiWindowDetector != nil {
+		if err := o.multiWindowDetector.isValid(); err != nil {
+			return false, err
+		}
+	}
+	if pid, ok := o.strategy.(*pidStrategy); ok {
+		if err := pid.isValid(); err != nil {
+			return false, err
+		}
+	}
+	if len(o.loadLevels) > 0 {
+		if o.strategy != nil {
+			return false, fmt.Errorf("loadLevels and strategy should not be set at the same time")
+		}
+		if err := isValidLoadLevels(o.loadLevels); err != nil {
+			return false, err
+		}
+	}
+	if o.warmUpPeriod < 0 || o.warmUpPeriod > maxRampPeriod {
+		return false, fmt.Errorf("warmUpPeriod should in [0, %v]", maxRampPeriod)
+	}
+	if o.warmUpInitialAdmitRatio < 0 || o.warmUpInitialAdmitRatio >= 1 {
+		return false, fmt.Errorf("warmUpInitialAdmitRatio should in [0, 1), 0.1 is recommended")
+	}
+	if o.relaxedRampPeriod < 0 || o.relaxedRampPeriod > maxRampPeriod {
+		return false, fmt.Errorf("relaxedRampPeriod should in [0, %v]", maxRampPeriod)
+	}
+	if _, ok := o.strategy.(stateMachineStrategy); o.relaxedRampPeriod > 0 && len(o.loadLevels) == 0 &&
+		(o.strategy == nil || ok) {
+		// 默认的状态机把按摩力度逐步降到0才回到轻松状态，回到轻松状态之后没有可以爬坡的按摩力度
+		return false, fmt.Errorf("relaxedRampPeriod should be used with strategy or loadLevels")
+	}
+	if o.stickySessionTTL < 0 {
+		return false, fmt.Errorf("stickySessionTTL should not less than 0")
+	}
+	if o.stickySessionTTL > 0 {
+		if o.maxStickySessions <= 0 || o.maxStickySessions > maxStickySessions {
+			return false, fmt.Errorf("maxStickySessions should in [1, %d]", maxStickySessions)
+		}
+		if o.maxStickyShare <= 0 || o.maxStickyShare > 1 {
+			return false, fmt.Errorf("maxStickyShare should in (0, 1], 0.5 is recommended")
+		}
+	}
+	if o.maxWaitQueueLength < 0 || o.maxWaitQueueLength > maxWaitQueueLength {
+		return false, fmt.Errorf("maxWaitQueueLength should in [0, %d]", maxWaitQueueLength)
+	}
+	if o.maxWaitQueueLength > 0 {
+		if o.waitOrder < WaitOrderFIFO || o.waitOrder > WaitOrderLIFO {
+			return false, fmt.Errorf("waitOrder:%d is invalid", o.waitOrder)
+		}
+		if o.maxWaitTime <= 0 || o.maxWaitTime > maxWaitTime {
+			return false, fmt.Errorf("maxWaitTime should in (0, %v]", maxWaitTime)
+		}
+	}
+	if o.rejectPattern < RejectPatternCounter || o.rejectPattern > RejectPatternSlidingWindow {
+		return false, fmt.Errorf("rejectPattern:%d is invalid", o.rejectPattern)
+	}
+	for key, weight := range o.tenantWeights {
+		if weight <= 0 {
+			return false, fmt.Errorf("weight of tenant %s should greater than 0", key)
+		}
+	}
+	if l := o.concurrencyLimiter; l != nil {
+		if l.algorithm == nil {
+			return false, fmt.Errorf("algorithm of concurrency limit should not be nil")
+		}
+		if l.minLimit < 1 || l.minLimit > l.limit || l.limit > l.maxLimit {
+			return false, fmt.Errorf("concurrency limit should satisfy 1 <= minLimit <= initialLimit <= maxLimit")
+		}
+	}
+	if o.snapshotter != nil {
+		if err := o.snapshotter.isValid(); err != nil {
+			return false, err
+		}
+		if err := o.snapshotter.isValidWith(o); err != nil {
+			return false, err
+		}
+	}
+	if o.gcPercentTuner != nil {
+		if o.gcPercentTuner.tiredGCPercent <= 0 {
+			return false, fmt.Errorf("tiredGCPercent should greater than 0, 400 is recommended")
+		}
+		if o.gcPercentTuner.memoryBudget == 0 {
+			return false, fmt.Errorf("memoryBudget should greater than 0")
+		}
+	}
 	return true, nil
 }
 
+// getHighLoadThreshold 获取高负荷阈值，设定了highLoadThreshold则优先使用
+func (o *options) getHighLoadThreshold() float64 {
+	if o.highLoadThreshold > 0 {
+		return o.highLoadThreshold
+	}
+	return o.highLoadLevel.threshold()
+}
+
+// getIncreaseStepIntensity 获取提高按摩力度的步进值
+func (o *options) getIncreaseStepIntensity() uint {
+	if o.increaseStepIntensity > 0 {
+		return o.increaseStepIntensity
+	}
+	return o.stepIntensity
+}
+
+// getDecreaseStepIntensity 获取降低按摩力度的步进值
+func (o *options) getDecreaseStepIntensity() uint {
+	if o.decreaseStepIntensity > 0 {
+		return o.decreaseStepIntensity
+	}
+	return o.stepIntensity
+}
+
+// getIncreaseCheckPeriod 获取提高按摩力度的检查周期
+func (o *options) getIncreaseCheckPeriod() time.Duration {
+	if o.increaseCheckPeriodInSeconds > 0 {
+		return time.Second * time.Duration(o.increaseCheckPeriodInSeconds)
+	}
+	return time.Second * time.Duration(o.checkPeriodInSeconds)
+}
+
+// getDecreaseCheckPeriod 获取降低按摩力度的检查周期
+func (o *options) getDecreaseCheckPeriod() time.Duration {
+	if o.decreaseCheckPeriodInSeconds > 0 {
+		return time.Second * time.Duration(o.decreaseCheckPeriodInSeconds)
+	}
+	return time.Second * time.Duration(o.checkPeriodInSeconds)
+}
+
+// getRandomSeed 获取随机数种子，没有设定则使用当前时间
+func (o *options) getRandomSeed() int64 {
+	if o.randomSeed != 0 {
+		return o.randomSeed
+	}
+	return time.Now().UnixNano()
+}
+
+// getWatchedThresholds 获取CPU使用率记录器需要记录的所有阈值
+func (o *options) getWatchedThresholds() []float64 {
+	thresholds := append([]float64{o.getHighLoadThreshold()}, o.recordThresholds...)
+	for _, l := range o.loadLevels {
+		thresholds = append(thresholds, l.EnterThreshold, l.ExitThreshold)
+	}
+	return thresholds
+}
+
 // Option 用来设定massagePlan的启动参数的函数
 type Option func(*options)
 
@@ -67,6 +320,37 @@ func WithHighLoadLevel(highLoadLevel CounterType) Option {
 	}
 }
 
+// WithHighLoadThreshold 用来设定massagePlan的高负荷阈值，和WithHighLoadLevel相比
+// 可以设定任意的CPU使用率，例如85
+func WithHighLoadThreshold(highLoadThreshold float64) Option {
+	return func(o *options) {
+		o.highLoadThreshold = highLoadThreshold
+	}
+}
+
+// WithRecorder 用来设定massagePlan的CPU使用率记录器，例如NewEWMARecorder、
+// NewSlidingWindowRecorder，不设定则使用默认的计数器记录器
+func WithRecorder(recorder Recorder) Option {
+	return func(o *options) {
+		o.recorder = recorder
+	}
+}
+
+// WithRecordThresholds 用来设定massagePlan的CPU使用率记录器额外记录的阈值
+func WithRecordThresholds(thresholds ...float64) Option {
+	return func(o *options) {
+		o.recordThresholds = thresholds
+	}
+}
+
+// WithRecordCap 用来设定massagePlan的CPU使用率记录器计数器的上限，
+// 也就是观察窗口包含的采集次数，例如60表示观察最近60秒的CPU使用率
+func WithRecordCap(recordCap uint) Option {
+	return func(o *options) {
+		o.recordCap = recordCap
+	}
+}
+
 // WithLoadStatusJudgeRatio 用来设定massagePlan的高负荷判别比例
 func WithLoadStatusJudgeRatio(loadStatusJudgeRatio float64) Option {
 	return func(o *options) {
@@ -74,6 +358,16 @@ func WithLoadStatusJudgeRatio(loadStatusJudgeRatio float64) Option {
 	}
 }
 
+// WithMultiWindow 用来设定massagePlan使用短、长两个窗口来判断高负荷，短窗口内高负荷
+// 记录的占比超过shortRatio(例如5秒内0.9)或者长窗口内超过longRatio(例如60秒内0.5)就进入
+// 疲累状态，两个窗口都不再超过的时候才会回到轻松状态，高负荷阈值和WithHighLoadThreshold一致
+func WithMultiWindow(shortWindow time.Duration, shortRatio float64,
+	longWindow time.Duration, longRatio float64) Option {
+	return func(o *options) {
+		o.multiWindowDetector = newMultiWindowDetector(shortWindow, shortRatio, longWindow, longRatio)
+	}
+}
+
 // WithInitialIntensity 用来设定massagePlan的初始按摩力度
 func WithInitialIntensity(initialIntensity uint) Option {
 	return func(o *options) {
@@ -94,3 +388,162 @@ func WithCheckPeriodInseconds(checkPeriodInseconds uint) Option {
 		o.checkPeriodInSeconds = checkPeriodInseconds
 	}
 }
+
+// WithAsymmetricStepIntensity 用来设定massagePlan提高、降低按摩力度各自的步进值，
+// 例如(20, 2)表示负荷升高时快速压下来，回落时慢慢恢复，为0的一方使用WithStepIntensity的设定
+func WithAsymmetricStepIntensity(increaseStepIntensity, decreaseStepIntensity uint) Option {
+	return func(o *options) {
+		o.increaseStepIntensity = increaseStepIntensity
+		o.decreaseStepIntensity = decreaseStepIntensity
+	}
+}
+
+// WithAsymmetricCheckPeriodInSeconds 用来设定massagePlan提高、降低按摩力度各自的检查周期，
+// 例如(1, 10)，为0的一方使用WithCheckPeriodInseconds的设定
+func WithAsymmetricCheckPeriodInSeconds(increaseCheckPeriodInSeconds, decreaseCheckPeriodInSeconds uint) Option {
+	return func(o *options) {
+		o.increaseCheckPeriodInSeconds = increaseCheckPeriodInSeconds
+		o.decreaseCheckPeriodInSeconds = decreaseCheckPeriodInSeconds
+	}
+}
+
+// WithMultiplicativeDecrease 用来设定massagePlan以乘性的方式降低按摩力度，
+// 每次降低都把按摩力度乘以decreaseFactor，例如0.9
+func WithMultiplicativeDecrease(decreaseFactor float64) Option {
+	return func(o *options) {
+		o.decreaseFactor = decreaseFactor
+	}
+}
+
+// WithAdaptiveGOGC 用来设定massagePlan在疲累状态下调高GOGC，tiredGCPercent是期望的GOGC，
+// memoryBudget是堆内存的预算，以字节为单位，实际的GOGC会保证下一次GC的堆目标不超过预算
+func WithAdaptiveGOGC(tiredGCPercent int, memoryBudget uint64) Option {
+	return func(o *options) {
+		o.gcPercentTuner = newGCPercentTuner(tiredGCPercent, memoryBudget)
+	}
+}
+
+// WithStrategy 用来设定massagePlan的控制策略，替换默认的轻松/疲累状态机，
+// 可以在自定义的控制策略中调用DefaultStrategy组合默认的状态机
+func WithStrategy(strategy Strategy) Option {
+	return func(o *options) {
+		o.strategy = strategy
+	}
+}
+
+// WithPIDController 用来设定massagePlan使用PID控制策略，setpoint是目标CPU使用率，
+// 例如75，kp、ki、kd分别是比例、积分、微分增益，按摩力度会被限制在[0, 100]
+func WithPIDController(setpoint, kp, ki, kd float64) Option {
+	return func(o *options) {
+		o.strategy = newPIDStrategy(setpoint, kp, ki, kd)
+	}
+}
+
+// WithLoadLevels 用来设定massagePlan的负荷等级，例如DefaultLoadLevels，等级需要按照
+// EnterThreshold从低到高排列，进入、退出阈值依据loadStatusJudgeRatio判断，
+// 可以使用CurrentLoadLevel查询当前的负荷等级
+func WithLoadLevels(levels ...LoadLevel) Option {
+	return func(o *options) {
+		o.loadLevels = levels
+	}
+}
+
+// WithRejectPattern 用来设定massagePlan在疲累状态下NeedMassage拒绝服务的方式，
+// 可以是RejectPatternCounter、RejectPatternBernoulli或者RejectPatternSlidingWindow
+func WithRejectPattern(pattern RejectPattern) Option {
+	return func(o *options) {
+		o.rejectPattern = pattern
+	}
+}
+
+// WithRandomSeed 用来设定RejectPatternBernoulli使用的随机数种子，便于复现拒绝的序列
+func WithRandomSeed(seed int64) Option {
+	return func(o *options) {
+		o.randomSeed = seed
+	}
+}
+
+// WithSlowStart 用来设定massagePlan的慢启动，启动之后的warmUpPeriod内不论CPU使用率如何，
+// 放行的请求比例都从initialAdmitRatio(例如0.1)线性增加到1，避免刚启动的实例在缓存、
+// 连接池还没有预热的时候就承接全部流量
+func WithSlowStart(warmUpPeriod time.Duration, initialAdmitRatio float64) Option {
+	return func(o *options) {
+		o.warmUpPeriod = warmUpPeriod
+		o.warmUpInitialAdmitRatio = initialAdmitRatio
+	}
+}
+
+// WithRelaxedRamp 用来设定massagePlan回到轻松状态之后的按摩力度爬坡，在rampPeriod内
+// 按摩力度从回到轻松状态前的按摩力度线性降到0，适用于控制策略、负荷等级这类会把按摩力度
+// 直接降为0的情况，人工强制保持轻松状态不会触发爬坡。默认的状态机本身就是逐步把按摩力度
+// 降到0再回到轻松状态的，需要和WithStrategy、WithPIDController或者WithLoadLevels一起使用
+func WithRelaxedRamp(rampPeriod time.Duration) Option {
+	return func(o *options) {
+		o.relaxedRampPeriod = rampPeriod
+	}
+}
+
+// WithStickySessions 用来设定NeedMassageForSession的粘性会话，需要拒绝服务期间被放行过的会话
+// 在最近一次放行之后的ttl之内继续放行，会话表最多记录maxSessions个会话，因为粘性而放行的
+// 请求数最多占按摩力度允许放行的请求数的maxStickyShare(例如0.5)，放行总量依然受按摩力度限制
+func WithStickySessions(ttl time.Duration, maxSessions int, maxStickyShare float64) Option {
+	return func(o *options) {
+		o.stickySessionTTL = ttl
+		o.maxStickySessions = maxSessions
+		o.maxStickyShare = maxStickyShare
+	}
+}
+
+// WithWaitQueue 用来设定Wait的等待队列，需要拒绝服务的时候调用方按照order排队，
+// 队列最多容纳maxLength个等待者，每个等待者最多等待maxWait
+func WithWaitQueue(order WaitOrder, maxLength int, maxWait time.Duration) Option {
+	return func(o *options) {
+		o.waitOrder = order
+		o.maxWaitQueueLength = maxLength
+		o.maxWaitTime = maxWait
+	}
+}
+
+// WithDryRun 用来设定massagePlan是否以试运行模式启动，试运行模式下NeedMassage等API总是
+// 返回不需要拒绝服务，本来需要拒绝的请求数可以通过GetRejectStats和WithRejectHook观察，
+// 可以在运行时使用SetDryRun切换
+func WithDryRun(dryRun bool) Option {
+	return func(o *options) {
+		o.dryRun = dryRun
+	}
+}
+
+// WithRejectHook 用来设定每次判断需要拒绝服务的时候调用的钩子，例如上报监控，
+// 试运行模式下也会调用，钩子会在业务routine中同步调用，需要尽快返回
+func WithRejectHook(hook RejectHook) Option {
+	return func(o *options) {
+		o.rejectHook = hook
+	}
+}
+
+// WithTenantWeights 用来设定NeedMassageFor中各个key的权重，没有设定的key权重为1，
+// 例如{"paid-tenant": 4}表示该key可以得到普通key四倍的公平份额
+func WithTenantWeights(weights map[string]float64) Option {
+	return func(o *options) {
+		o.tenantWeights = weights
+	}
+}
+
+// WithConcurrencyLimit 用来设定massagePlan的自适应并发限制，algorithm可以是NewGradientLimit
+// 或者NewVegasLimit，并发限制从initialLimit开始在[minLimit, maxLimit]范围内调整，
+// 配合Acquire使用，CPU疲累时会按照按摩力度把并发限制按比例收紧
+func WithConcurrencyLimit(algorithm LimitAlgorithm, initialLimit, minLimit, maxLimit uint) Option {
+	return func(o *options) {
+		o.concurrencyLimiter = newConcurrencyLimiter(algorithm, initialLimit, minLimit, maxLimit)
+	}
+}
+
+// WithSnapshot 用来设定massagePlan保存和恢复状态快照，Stop的时候以及每隔saveInterval
+// (为0则只在Stop的时候)把记录器的计数器、状态、按摩力度等写入snapshotFile，启动的时候
+// 如果快照的保存时间在maxAge之内则从快照恢复，缩短重启之后重新判断过载的时间，
+// 只支持计数器记录器，不能和WithStrategy、WithLoadLevels一起使用
+func WithSnapshot(snapshotFile string, maxAge, saveInterval time.Duration) Option {
+	return func(o *options) {
+		o.snapshotter = newPlanSnapshotter(snapshotFile, maxAge, saveInterval)
+	}
+}
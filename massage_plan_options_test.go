@@ -2,6 +2,7 @@ package cpumassager
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 )
@@ -40,3 +41,68 @@ func TestOptions(t *testing.T) {
 	require.Equal(uint(defaultStepIntensity), options.stepIntensity)
 	require.Equal(uint(defaultCheckPeriodInSeconds), options.checkPeriodInSeconds)
 }
+
+func TestHighLoadThresholdOptions(t *testing.T) {
+	require := require.New(t)
+	linuxCPUsageCollector, _ := NewLinuxCPUsageCollector()
+	options := &options{loadStatusJudgeRatio: 0.2}
+	WithCPUSageCollector(linuxCPUsageCollector)(options)
+	WithHighLoadLevel(CounterTypeSeventy)(options)
+	require.True(options.isValid())
+	require.Equal(70.0, options.getHighLoadThreshold())
+
+	WithHighLoadThreshold(85)(options)
+	WithRecordThresholds(75, 95)(options)
+	WithRecordCap(60)(options)
+	require.True(options.isValid())
+	require.Equal(85.0, options.getHighLoadThreshold())
+	require.Equal([]float64{75, 95}, options.recordThresholds)
+	require.Equal(uint(60), options.recordCap)
+
+	var invalidOptions = []Option{
+		WithHighLoadThreshold(101),
+		WithRecordThresholds(-1),
+		WithRecordCap(minRecordCap - 1),
+		WithRecordCap(maxRecordCap + 1),
+	}
+	for _, o := range invalidOptions {
+		invalid := *options
+		o(&invalid)
+		require.False(invalid.isValid())
+	}
+}
+
+func TestAsymmetricRampOptions(t *testing.T) {
+	require := require.New(t)
+	linuxCPUsageCollector, _ := NewLinuxCPUsageCollector()
+	options := &options{loadStatusJudgeRatio: 0.2, stepIntensity: 1, checkPeriodInSeconds: 3}
+	WithCPUSageCollector(linuxCPUsageCollector)(options)
+	require.True(options.isValid())
+	require.Equal(uint(1), options.getIncreaseStepIntensity())
+	require.Equal(uint(1), options.getDecreaseStepIntensity())
+	require.Equal(3*time.Second, options.getIncreaseCheckPeriod())
+	require.Equal(3*time.Second, options.getDecreaseCheckPeriod())
+
+	WithAsymmetricStepIntensity(maxIncreaseStepIntensity, 2)(options)
+	WithAsymmetricCheckPeriodInSeconds(1, maxDecreaseCheckPeriodInSeconds)(options)
+	WithMultiplicativeDecrease(0.9)(options)
+	require.True(options.isValid())
+	require.Equal(uint(maxIncreaseStepIntensity), options.getIncreaseStepIntensity())
+	require.Equal(uint(2), options.getDecreaseStepIntensity())
+	require.Equal(time.Second, options.getIncreaseCheckPeriod())
+	require.Equal(maxDecreaseCheckPeriodInSeconds*time.Second, options.getDecreaseCheckPeriod())
+
+	var invalidOptions = []Option{
+		WithAsymmetricStepIntensity(maxIncreaseStepIntensity+1, 2),
+		WithAsymmetricStepIntensity(20, maxStepIntensity+1),
+		WithAsymmetricCheckPeriodInSeconds(maxCheckPeriodInSeconds+1, 10),
+		WithAsymmetricCheckPeriodInSeconds(1, maxDecreaseCheckPeriodInSeconds+1),
+		WithMultiplicativeDecrease(0.1),
+		WithMultiplicativeDecrease(1),
+	}
+	for _, o := range invalidOptions {
+		invalid := *options
+		o(&invalid)
+		require.False(invalid.isValid())
+	}
+}
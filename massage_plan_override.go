@@ -0,0 +1,95 @@
+package cpumassager
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// OverrideMode 人工干预的模式
+type OverrideMode int
+
+const (
+	// OverrideModeTired 强制进入疲累状态，并以指定的按摩力度拒绝服务
+	OverrideModeTired OverrideMode = iota + 1
+	// OverrideModeRelaxed 强制保持轻松状态，不拒绝服务
+	OverrideModeRelaxed
+)
+
+func (m OverrideMode) String() string {
+	switch m {
+	case OverrideModeTired:
+		return "tired"
+	case OverrideModeRelaxed:
+		return "relaxed"
+	}
+	return fmt.Sprintf("OverrideMode(%d)", int(m))
+}
+
+// OverrideStatus 人工干预的状态
+type OverrideStatus struct {
+	Mode OverrideMode
+	// Intensity 强制的按摩力度，只对OverrideModeTired有效
+	Intensity uint
+	// ExpireTime 人工干预的过期时间，过期之后恢复自动控制
+	ExpireTime time.Time
+}
+
+// Override 人工干预按摩计划，在ttl之内强制进入疲累状态并以intensity拒绝服务，或者强制保持
+// 轻松状态，干预期间依然会收集和记录CPU使用率，过期或者调用ClearOverride之后恢复自动控制
+func (p *massagePlan) Override(mode OverrideMode, intensity uint, ttl time.Duration) error {
+	if mode != OverrideModeTired && mode != OverrideModeRelaxed {
+		return fmt.Errorf("override mode:%d is invalid", int(mode))
+	}
+	if mode == OverrideModeTired && (intensity == emptyIntensity || intensity > fullIntensity) {
+		return fmt.Errorf("intensity should in (0, %d] when override tired", fullIntensity)
+	}
+	if ttl <= 0 {
+		return fmt.Errorf("ttl should greater than 0")
+	}
+	p.controlMu.Lock()
+	defer p.controlMu.Unlock()
+	p.setOverride(&OverrideStatus{Mode: mode, Intensity: intensity, ExpireTime: time.Now().Add(ttl)})
+	if mode == OverrideModeTired {
+		p.applyIntensity(intensity)
+		return nil
+	}
+	// 人工强制保持轻松状态不触发回到轻松状态之后的按摩力度爬坡，进行中的爬坡也一并取消，
+	// 避免干预结束之后又突然拒绝服务
+	p.relaxedTime = time.Time{}
+	p.relaxedFromIntensity = emptyIntensity
+	if p.isTired() {
+		p.relax()
+	}
+	return nil
+}
+
+// ClearOverride 取消人工干预，下一次收集CPU使用率的时候恢复自动控制
+func (p *massagePlan) ClearOverride() {
+	p.controlMu.Lock()
+	defer p.controlMu.Unlock()
+	p.setOverride(nil)
+}
+
+// setOverride 设定人工干预的状态，需要持有controlMu
+func (p *massagePlan) setOverride(override *OverrideStatus) {
+	p.override = override
+	var expireTime int64
+	if override != nil && override.Mode == OverrideModeRelaxed {
+		expireTime = override.ExpireTime.UnixNano()
+	}
+	atomic.StoreInt64(&p.relaxedOverrideExpireTime, expireTime)
+}
+
+// isRelaxedOverridden now时刻是否处于强制保持轻松状态的人工干预中，不需要持有controlMu
+func (p *massagePlan) isRelaxedOverridden(now time.Time) bool {
+	return now.UnixNano() < atomic.LoadInt64(&p.relaxedOverrideExpireTime)
+}
+
+// isOverridden 当前是否处于人工干预中，过期的人工干预会被清除，需要持有controlMu
+func (p *massagePlan) isOverridden(now time.Time) bool {
+	if p.override != nil && !now.Before(p.override.ExpireTime) {
+		p.setOverride(nil)
+	}
+	return p.override != nil
+}
@@ -0,0 +1,77 @@
+package cpumassager
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMassagePlanOverride(t *testing.T) {
+	require := require.New(t)
+	mp := massagePlan{
+		opts: options{
+			cpusageCollector:     collectorFunc(func() float64 { return 100 }),
+			loadStatusJudgeRatio: 0.2,
+			initialIntensity:     50,
+			stepIntensity:        1,
+			recorder:             NewCounterRecorder(10),
+		},
+		currentState: stateRelaxed{},
+	}
+	require.NotNil(mp.Override(OverrideMode(0), 0, time.Minute))
+	require.NotNil(mp.Override(OverrideModeTired, 0, time.Minute))
+	require.NotNil(mp.Override(OverrideModeTired, fullIntensity+1, time.Minute))
+	require.NotNil(mp.Override(OverrideModeRelaxed, 0, 0))
+
+	// 强制进入疲累状态并以指定的按摩力度拒绝服务
+	require.Nil(mp.Override(OverrideModeTired, fullIntensity, time.Minute))
+	require.True(mp.isTired())
+	require.True(mp.NeedMassage())
+	status := mp.GetMassageStatus()
+	require.Equal(uint(fullIntensity), status.Intensity)
+	require.Equal(OverrideModeTired, status.Override.Mode)
+	require.Equal("tired", status.Override.Mode.String())
+
+	// 强制保持轻松状态，期间依然记录CPU使用率
+	require.Nil(mp.Override(OverrideModeRelaxed, 0, time.Minute))
+	for i := 0; i < 5; i++ {
+		mp.AddACPUsageRecord()
+	}
+	require.True(mp.isRelaxed())
+	require.False(mp.NeedMassage())
+	require.Equal(0.5, mp.getRecorder().GetLoadRatio(80))
+
+	// 取消人工干预之后自动控制按照已经记录的CPU使用率接上
+	mp.ClearOverride()
+	require.Nil(mp.GetMassageStatus().Override)
+	mp.AddACPUsageRecord()
+	require.True(mp.isTired())
+
+	// 人工干预过期之后自动恢复
+	require.Nil(mp.Override(OverrideModeRelaxed, 0, time.Millisecond))
+	require.NotNil(mp.GetMassageStatus().Override)
+	time.Sleep(2 * time.Millisecond)
+	require.Nil(mp.GetMassageStatus().Override)
+	mp.AddACPUsageRecord()
+	require.True(mp.isTired())
+}
+
+func TestGetMassageStatus(t *testing.T) {
+	require := require.New(t)
+	mp := massagePlan{
+		opts:         options{initialIntensity: 30},
+		currentState: stateRelaxed{},
+	}
+	require.Equal(MassageStatus{LoadLevel: LoadLevelRelaxed}, mp.GetMassageStatus())
+	mp.SetTired()
+	mp.SetDryRun(true)
+	mp.NeedMassage()
+	require.Equal(MassageStatus{
+		LoadLevel:   LoadLevelTired,
+		Tired:       true,
+		Intensity:   30,
+		DryRun:      true,
+		RejectStats: RejectStats{Requests: 1, WouldRejected: 1},
+	}, mp.GetMassageStatus())
+}
@@ -0,0 +1,67 @@
+package cpumassager
+
+import (
+	"math"
+	"sync/atomic"
+)
+
+// Priority 请求的优先级，数值越大越重要，疲累时按摩力度优先落在优先级低的请求上，
+// 除了下面几个常用的等级，也可以使用[0, maxPriorities)之间的任意数值自定义等级
+type Priority uint8
+
+const (
+	// PriorityBatch 批处理、爬虫这类可以随时放弃的请求，最先被拒绝
+	PriorityBatch Priority = 0
+	// PrioritySheddable 可以拒绝的普通请求
+	PrioritySheddable Priority = 1
+	// PriorityDefault 默认优先级的请求
+	PriorityDefault Priority = 2
+	// PriorityCritical 健康检查、支付、管理接口这类关键请求，只有在更低优先级的请求
+	// 已经全部被拒绝时才会被拒绝
+	PriorityCritical Priority = 3
+
+	maxPriorities = 8
+)
+
+// priorityRejectRatio 计算指定优先级的请求需要拒绝的比例：按照按摩力度算出需要拒绝的
+// 请求总数，从优先级最低的请求开始拒绝，低优先级的请求全部拒绝之后才轮到高优先级的请求
+func (p *massagePlan) priorityRejectRatio(priority Priority, intensity uint) float64 {
+	var totalTasks uint64
+	var todoTasks [maxPriorities]uint64
+	for i := range todoTasks {
+		todoTasks[i] = atomic.LoadUint64(&p.priorityTodoTasks[i])
+		totalTasks += todoTasks[i]
+	}
+	rejectTasks := float64(totalTasks) * float64(intensity) / fullIntensity
+	for i := Priority(0); i < priority; i++ {
+		rejectTasks -= float64(todoTasks[i])
+	}
+	if rejectTasks <= 0 {
+		return 0
+	}
+	if todoTasks[priority] == 0 {
+		return 1
+	}
+	return math.Min(1, rejectTasks/float64(todoTasks[priority]))
+}
+
+// canDoWorkInTiredWithPriority 疲累状态下按照优先级各自的待处理、已处理任务数判断是否可以处理
+func (p *massagePlan) canDoWorkInTiredWithPriority(priority Priority, intensity uint) bool {
+	todoTasks := atomic.AddUint64(&p.priorityTodoTasks[priority], 1)
+	requireTasks := uint64(float64(todoTasks) * (1 - p.priorityRejectRatio(priority, intensity)))
+	if atomic.LoadUint64(&p.priorityDoneTasks[priority]) < requireTasks {
+		atomic.AddUint64(&p.priorityDoneTasks[priority], 1)
+		return true
+	}
+	return false
+}
+
+// NeedMassageWithPriority 和NeedMassage一样判断是否需要拒绝服务，但是会按照优先级分配按摩力度，
+// 超出范围的优先级按照最高优先级处理
+func (p *massagePlan) NeedMassageWithPriority(priority Priority) bool {
+	if priority >= maxPriorities {
+		priority = maxPriorities - 1
+	}
+	intensity := p.getIntensity()
+	return p.finishDecision(intensity, intensity > emptyIntensity && !p.canDoWorkInTiredWithPriority(priority, intensity))
+}
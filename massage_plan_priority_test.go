@@ -0,0 +1,50 @@
+package cpumassager
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNeedMassageWithPriority(t *testing.T) {
+	require := require.New(t)
+	mp := massagePlan{
+		opts:         options{initialIntensity: 30},
+		currentState: stateRelaxed{},
+	}
+	require.False(mp.NeedMassageWithPriority(PriorityBatch))
+
+	// 按摩力度先落在低优先级的请求上
+	countRejected := func(priorities ...Priority) map[Priority]int {
+		rejected := map[Priority]int{}
+		for i := 0; i < 100; i++ {
+			for _, priority := range priorities {
+				if mp.NeedMassageWithPriority(priority) {
+					rejected[priority]++
+				}
+			}
+		}
+		return rejected
+	}
+	mp.SetTired()
+	rejected := countRejected(PriorityBatch, PriorityDefault)
+	require.InDelta(60, rejected[PriorityBatch], 2)
+	require.Equal(0, rejected[PriorityDefault])
+
+	// 低优先级的请求全部拒绝之后才会拒绝关键请求
+	mp.currentIntensity = 60
+	mp.clearWorkspace()
+	rejected = countRejected(PriorityBatch, PriorityCritical)
+	require.InDelta(100, rejected[PriorityBatch], 2)
+	require.InDelta(20, rejected[PriorityCritical], 2)
+
+	mp.currentIntensity = fullIntensity
+	mp.clearWorkspace()
+	rejected = countRejected(PrioritySheddable, PriorityCritical, Priority(maxPriorities+1))
+	require.Equal(100, rejected[PrioritySheddable])
+	require.Equal(100, rejected[PriorityCritical])
+	require.Equal(100, rejected[Priority(maxPriorities+1)])
+
+	mp.SetRelaxed()
+	require.Equal(0, len(countRejected(PriorityBatch)))
+}
@@ -0,0 +1,48 @@
+package cpumassager
+
+import (
+	"math"
+	"time"
+)
+
+// maxRampPeriod 慢启动等按摩力度爬坡的最长时间
+const maxRampPeriod = 10 * time.Minute
+
+// getRampIntensity 获取按摩力度爬坡在now时刻的按摩力度：
+// 1. 启动之后的预热期内，放行的请求比例从warmUpInitialAdmitRatio线性增加到1；
+// 2. 回到轻松状态之后的relaxedRampPeriod内，按摩力度从回到轻松状态前的按摩力度线性降到0
+func (p *massagePlan) getRampIntensity(now time.Time) uint {
+	intensity := 0.0
+	if elapsed := now.Sub(p.startTime); p.opts.warmUpPeriod > 0 && elapsed < p.opts.warmUpPeriod {
+		progress := math.Max(0, float64(elapsed)/float64(p.opts.warmUpPeriod))
+		admitRatio := p.opts.warmUpInitialAdmitRatio + (1-p.opts.warmUpInitialAdmitRatio)*progress
+		intensity = fullIntensity * (1 - admitRatio)
+	}
+	if elapsed := now.Sub(p.relaxedTime); p.opts.relaxedRampPeriod > 0 && elapsed < p.opts.relaxedRampPeriod {
+		progress := math.Max(0, float64(elapsed)/float64(p.opts.relaxedRampPeriod))
+		intensity = math.Max(intensity, float64(p.relaxedFromIntensity)*(1-progress))
+	}
+	return uint(math.Round(intensity))
+}
+
+// getIntensity 获取当前实际生效的按摩力度，也就是疲累状态的按摩力度、按摩力度爬坡以及排空
+// 的按摩力度中最大的一个，各种判断是否需要拒绝服务的方式都依据该按摩力度，
+// 强制保持轻松状态的人工干预期间不做按摩力度爬坡
+func (p *massagePlan) getIntensity() uint {
+	intensity := uint(emptyIntensity)
+	if p.isTired() {
+		intensity = p.currentIntensity
+	}
+	if p.opts.warmUpPeriod > 0 || p.opts.relaxedRampPeriod > 0 {
+		now := time.Now()
+		if rampIntensity := p.getRampIntensity(now); rampIntensity > intensity && !p.isRelaxedOverridden(now) {
+			intensity = rampIntensity
+		}
+	}
+	if p.getDrain() != nil {
+		if drainIntensity := p.getDrainIntensity(time.Now()); drainIntensity > intensity {
+			intensity = drainIntensity
+		}
+	}
+	return intensity
+}
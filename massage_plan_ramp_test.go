@@ -0,0 +1,137 @@
+package cpumassager
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSlowStart(t *testing.T) {
+	require := require.New(t)
+	mp := massagePlan{
+		opts: options{
+			cpusageCollector:     collectorFunc(func() float64 { return 0 }),
+			loadStatusJudgeRatio: 0.2,
+			initialIntensity:     50,
+		},
+		currentState: stateRelaxed{},
+	}
+	WithSlowStart(10*time.Second, 0.1)(&mp.opts)
+	require.True(mp.opts.isValid())
+	mp.startTime = time.Now()
+
+	// 预热期内放行的请求比例从0.1线性增加到1，和CPU使用率无关
+	require.Equal(uint(90), mp.getRampIntensity(mp.startTime))
+	require.Equal(uint(45), mp.getRampIntensity(mp.startTime.Add(5*time.Second)))
+	require.Equal(uint(emptyIntensity), mp.getRampIntensity(mp.startTime.Add(10*time.Second)))
+	rejected := 0
+	for i := 0; i < 100; i++ {
+		if mp.NeedMassage() {
+			rejected++
+		}
+	}
+	require.InDelta(90, rejected, 2)
+
+	// 疲累状态的按摩力度更高的时候以疲累状态为准
+	mp.startTime = time.Now().Add(-9 * time.Second)
+	require.InDelta(9, mp.getIntensity(), 1)
+	mp.SetTired()
+	require.Equal(uint(50), mp.getIntensity())
+
+	var invalidOptions = []Option{
+		WithSlowStart(-time.Second, 0.1),
+		WithSlowStart(maxRampPeriod+time.Second, 0.1),
+		WithSlowStart(time.Second, 1),
+		WithRelaxedRamp(maxRampPeriod + time.Second),
+	}
+	for _, o := range invalidOptions {
+		invalid := mp.opts
+		o(&invalid)
+		require.False(invalid.isValid())
+	}
+}
+
+func TestRelaxedRamp(t *testing.T) {
+	require := require.New(t)
+	strategy := &scriptedStrategy{intensities: []uint{80, 0, 80, 0}}
+	mp := massagePlan{
+		opts: options{
+			cpusageCollector:     collectorFunc(func() float64 { return 90 }),
+			highLoadThreshold:    85,
+			loadStatusJudgeRatio: 0.2,
+			initialIntensity:     50,
+		},
+		currentState: stateRelaxed{},
+	}
+	WithStrategy(strategy)(&mp.opts)
+	mp.AddACPUsageRecord()
+	mp.AddACPUsageRecord()
+	require.True(mp.isRelaxed())
+	require.Equal(uint(emptyIntensity), mp.getIntensity())
+
+	// 控制策略把按摩力度直接降为0的时候，按摩力度从之前的按摩力度线性降到0
+	WithRelaxedRamp(20 * time.Second)(&mp.opts)
+	require.True(mp.opts.isValid())
+	mp.AddACPUsageRecord()
+	require.True(mp.isTired())
+	mp.AddACPUsageRecord()
+	require.True(mp.isRelaxed())
+	require.Equal(uint(80), mp.relaxedFromIntensity)
+	require.Equal(uint(60), mp.getRampIntensity(mp.relaxedTime.Add(5*time.Second)))
+	require.Equal(uint(emptyIntensity), mp.getRampIntensity(mp.relaxedTime.Add(20*time.Second)))
+	require.True(mp.NeedMassage())
+	require.Equal(uint64(1), mp.todoTaskNum())
+	require.LessOrEqual(mp.GetMassageStatus().Intensity, uint(80))
+	require.False(mp.GetMassageStatus().Tired)
+
+	// 默认的状态机逐步把按摩力度降到0，不能使用回到轻松状态之后的爬坡
+	opts := options{cpusageCollector: collectorFunc(func() float64 { return 0 }), loadStatusJudgeRatio: 0.2}
+	WithRelaxedRamp(20 * time.Second)(&opts)
+	require.False(opts.isValid())
+	WithStrategy(DefaultStrategy())(&opts)
+	require.False(opts.isValid())
+	WithStrategy(nil)(&opts)
+	WithLoadLevels(DefaultLoadLevels()...)(&opts)
+	require.True(opts.isValid())
+}
+
+func TestRampWithRelaxedOverride(t *testing.T) {
+	require := require.New(t)
+	mp := massagePlan{
+		opts:         options{initialIntensity: 80},
+		currentState: stateRelaxed{},
+	}
+	WithSlowStart(time.Minute, 0.5)(&mp.opts)
+	WithRelaxedRamp(time.Minute)(&mp.opts)
+	mp.startTime = time.Now()
+	mp.SetTired()
+	require.Equal(uint(80), mp.getIntensity())
+
+	// 强制保持轻松状态的人工干预期间，预热和回到轻松状态之后的爬坡都不拒绝服务
+	require.Nil(mp.Override(OverrideModeRelaxed, 0, time.Minute))
+	require.True(mp.isRelaxed())
+	require.Equal(uint(emptyIntensity), mp.getIntensity())
+	for i := 0; i < 10; i++ {
+		require.False(mp.NeedMassage())
+	}
+	require.Equal(uint(emptyIntensity), mp.GetMassageStatus().Intensity)
+
+	// 人工强制保持轻松状态不触发回到轻松状态之后的爬坡，取消人工干预之后只有预热
+	require.True(mp.relaxedTime.IsZero())
+	mp.ClearOverride()
+	require.InDelta(50, mp.getIntensity(), 2)
+
+	// 进行中的爬坡也会被人工强制保持轻松状态取消
+	mp.SetTired()
+	mp.currentIntensity = 90
+	mp.SetRelaxed()
+	require.InDelta(90, mp.getIntensity(), 2)
+	require.Nil(mp.Override(OverrideModeRelaxed, 0, time.Minute))
+	mp.ClearOverride()
+	require.InDelta(50, mp.getIntensity(), 2)
+
+	// 强制进入疲累状态的人工干预不影响预热
+	require.Nil(mp.Override(OverrideModeTired, 10, time.Minute))
+	require.InDelta(50, mp.getIntensity(), 2)
+}
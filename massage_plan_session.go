@@ -0,0 +1,131 @@
+package cpumassager
+
+import (
+	"container/list"
+	"math"
+	"sync"
+	"time"
+)
+
+// maxStickySessions 粘性会话表最多可以设定的会话个数
+const maxStickySessions = 1000000
+
+// sessionTracker 粘性会话的准入控制：需要拒绝服务的时候被放行过的会话在ttl之内继续放行，
+// 由新的会话承担拒绝，粘性放行的请求数不超过放行总量的maxStickyShare，会话表最多记录maxSessions个会话
+type sessionTracker struct {
+	mu             sync.Mutex
+	ttl            time.Duration
+	maxSessions    int
+	maxStickyShare float64
+
+	// sessions 会话在expiries中的位置
+	sessions map[string]*list.Element
+	// expiries 按照最近一次被放行的时间从早到晚排列的会话，表头最先过期
+	expiries *list.List
+	// todoTasks、doneTasks 待处理、已处理任务，stickyTodoTasks、stickyDoneTasks 其中来自活跃
+	// 会话的任务和因为粘性而放行的任务，在按摩计划清空工作区的时候清空
+	todoTasks       uint64
+	doneTasks       uint64
+	stickyTodoTasks uint64
+	stickyDoneTasks uint64
+
+	now func() time.Time
+}
+
+// sessionEntry 会话表中的一个会话
+type sessionEntry struct {
+	key      string
+	lastSeen time.Time
+}
+
+func newSessionTracker(ttl time.Duration, maxSessions int, maxStickyShare float64) *sessionTracker {
+	return &sessionTracker{
+		ttl:            ttl,
+		maxSessions:    maxSessions,
+		maxStickyShare: maxStickyShare,
+		sessions:       make(map[string]*list.Element),
+		expiries:       list.New(),
+		now:            time.Now,
+	}
+}
+
+// reset 清空待处理、已处理任务，会话表保留
+func (t *sessionTracker) reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.todoTasks = 0
+	t.doneTasks = 0
+	t.stickyTodoTasks = 0
+	t.stickyDoneTasks = 0
+}
+
+// isActive 会话在now时刻是否依然活跃，需要持有mu
+func (t *sessionTracker) isActive(key string, now time.Time) bool {
+	elem, ok := t.sessions[key]
+	return ok && now.Sub(elem.Value.(*sessionEntry).lastSeen) < t.ttl
+}
+
+// evictExpired 从表头开始清除now时刻已经过期的会话，需要持有mu
+func (t *sessionTracker) evictExpired(now time.Time) {
+	for elem := t.expiries.Front(); elem != nil; elem = t.expiries.Front() {
+		entry := elem.Value.(*sessionEntry)
+		if now.Sub(entry.lastSeen) < t.ttl {
+			return
+		}
+		t.expiries.Remove(elem)
+		delete(t.sessions, entry.key)
+	}
+}
+
+// remember 记录会话被放行，会话表满了的时候先清除过期的会话，依然满的话不记录，需要持有mu
+func (t *sessionTracker) remember(key string, now time.Time) {
+	if elem, ok := t.sessions[key]; ok {
+		elem.Value.(*sessionEntry).lastSeen = now
+		t.expiries.MoveToBack(elem)
+		return
+	}
+	if len(t.sessions) >= t.maxSessions {
+		t.evictExpired(now)
+		if len(t.sessions) >= t.maxSessions {
+			return
+		}
+	}
+	t.sessions[key] = t.expiries.PushBack(&sessionEntry{key: key, lastSeen: now})
+}
+
+// canDoWork 按照按摩力度判断会话的请求是否可以处理。放行总量不超过按摩力度允许的余量，其中
+// 活跃会话最多可以占用余量的maxStickyShare，这部分预留给活跃会话，新的会话以及超出这部分的
+// 活跃会话只能使用剩下的余量
+func (t *sessionTracker) canDoWork(key string, intensity uint) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := t.now()
+	t.todoTasks++
+	active := t.isActive(key, now)
+	if active {
+		t.stickyTodoTasks++
+	}
+	requireTasks := float64(t.todoTasks * (fullIntensity - uint64(intensity)) / fullIntensity)
+	if float64(t.doneTasks) >= requireTasks {
+		return false
+	}
+	stickyTasks := math.Min(requireTasks*t.maxStickyShare, float64(t.stickyTodoTasks))
+	if active && float64(t.stickyDoneTasks) < stickyTasks {
+		t.stickyDoneTasks++
+	} else if float64(t.doneTasks-t.stickyDoneTasks)+stickyTasks >= requireTasks {
+		return false
+	}
+	t.doneTasks++
+	t.remember(key, now)
+	return true
+}
+
+// NeedMassageForSession 和NeedMassage一样判断是否需要拒绝服务，但是需要拒绝服务期间被放行过的
+// 会话会继续放行，由新的会话承担拒绝，没有设定WithStickySessions的话和NeedMassage一致
+func (p *massagePlan) NeedMassageForSession(sessionKey string) bool {
+	if p.sessionTracker == nil {
+		return p.NeedMassage()
+	}
+	intensity := p.getIntensity()
+	return p.finishDecision(intensity, intensity > emptyIntensity && !p.sessionTracker.canDoWork(sessionKey, intensity))
+}
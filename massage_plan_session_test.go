@@ -0,0 +1,134 @@
+package cpumassager
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNeedMassageForSession(t *testing.T) {
+	require := require.New(t)
+	mp := massagePlan{
+		opts: options{
+			cpusageCollector:     collectorFunc(func() float64 { return 0 }),
+			loadStatusJudgeRatio: 0.2,
+			initialIntensity:     50,
+		},
+		currentState: stateRelaxed{},
+	}
+	// 没有设定粘性会话的时候和NeedMassage一致
+	require.False(mp.NeedMassageForSession("session"))
+
+	WithStickySessions(time.Minute, 100, 1)(&mp.opts)
+	require.True(mp.opts.isValid())
+	mp.sessionTracker = newSessionTracker(mp.opts.stickySessionTTL, mp.opts.maxStickySessions, mp.opts.maxStickyShare)
+	now := time.Now()
+	mp.sessionTracker.now = func() time.Time { return now }
+	mp.SetTired()
+
+	var activeSessions []string
+	for i := 0; i < 10; i++ {
+		session := fmt.Sprintf("session-%d", i)
+		if !mp.NeedMassageForSession(session) {
+			activeSessions = append(activeSessions, session)
+		}
+	}
+	require.Equal(5, len(activeSessions))
+
+	// 已经放行的会话优先放行，由新的会话承担拒绝，放行总量依然不超过余量
+	mp.clearWorkspace()
+	admittedActive, admittedNew := 0, 0
+	for i := 0; i < 10; i++ {
+		for _, session := range activeSessions {
+			if !mp.NeedMassageForSession(session) {
+				admittedActive++
+			}
+		}
+		for j := 0; j < 5; j++ {
+			if !mp.NeedMassageForSession(fmt.Sprintf("new-session-%d-%d", i, j)) {
+				admittedNew++
+			}
+		}
+	}
+	require.Equal(47, admittedActive)
+	require.Equal(0, admittedNew)
+
+	// 按摩力度为100的时候活跃会话也需要拒绝
+	mp.applyIntensity(fullIntensity)
+	require.True(mp.NeedMassageForSession(activeSessions[0]))
+	mp.applyIntensity(50)
+
+	// 会话过期之后按照新会话处理
+	now = now.Add(time.Minute)
+	mp.clearWorkspace()
+	require.True(mp.NeedMassageForSession(activeSessions[0]))
+}
+
+func TestSessionTrackerStickyShare(t *testing.T) {
+	require := require.New(t)
+	tracker := newSessionTracker(time.Minute, 100, 0.5)
+	for i := 0; i < 10; i++ {
+		tracker.canDoWork(fmt.Sprintf("session-%d", i), 50)
+	}
+
+	// 粘性放行最多占用余量的maxStickyShare，剩下的余量留给新的会话
+	tracker.reset()
+	admittedActive, admittedNew := 0, 0
+	for i := 0; i < 10; i++ {
+		for j := 0; j < 5; j++ {
+			if tracker.canDoWork(fmt.Sprintf("session-%d", 2*j+1), 50) {
+				admittedActive++
+			}
+		}
+		for j := 0; j < 5; j++ {
+			if tracker.canDoWork(fmt.Sprintf("new-session-%d-%d", i, j), 50) {
+				admittedNew++
+			}
+		}
+	}
+	require.Equal(29, admittedActive)
+	require.Equal(20, admittedNew)
+
+	// 只有活跃会话的时候放行总量也不超过余量
+	tracker.reset()
+	rejected := 0
+	for i := 0; i < 20; i++ {
+		for j := 0; j < 5; j++ {
+			if !tracker.canDoWork(fmt.Sprintf("session-%d", 2*j+1), 50) {
+				rejected++
+			}
+		}
+	}
+	require.Equal(50, rejected)
+}
+
+func TestSessionTrackerBounded(t *testing.T) {
+	require := require.New(t)
+	tracker := newSessionTracker(time.Minute, 2, 1)
+	now := time.Now()
+	tracker.now = func() time.Time { return now }
+	tracker.remember("a", now)
+	tracker.remember("b", now)
+	tracker.remember("c", now)
+	require.Equal(2, len(tracker.sessions))
+	require.False(tracker.isActive("c", now))
+
+	// 会话表满了的时候按照最近一次放行的时间清除过期的会话，最近放行过的会话保留
+	tracker.remember("a", now.Add(30*time.Second))
+	now = now.Add(time.Minute)
+	tracker.remember("c", now)
+	require.Equal(2, len(tracker.sessions))
+	require.True(tracker.isActive("a", now))
+	require.False(tracker.isActive("b", now))
+	require.True(tracker.isActive("c", now))
+
+	invalid := options{cpusageCollector: collectorFunc(func() float64 { return 0 }), loadStatusJudgeRatio: 0.2}
+	WithStickySessions(time.Minute, 0, 0.5)(&invalid)
+	require.False(invalid.isValid())
+	WithStickySessions(time.Minute, 10, 0)(&invalid)
+	require.False(invalid.isValid())
+	WithStickySessions(-time.Minute, 10, 0.5)(&invalid)
+	require.False(invalid.isValid())
+}
@@ -0,0 +1,205 @@
+package cpumassager
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// planSnapshot massagePlan的状态快照，用来在重启之后恢复状态，
+// 避免重启后记录器从零开始积累，在过载时放进大约20秒的全部流量
+type planSnapshot struct {
+	SaveTime            time.Time `json:"save_time"`
+	Tired               bool      `json:"tired"`
+	CurrentIntensity    uint      `json:"current_intensity"`
+	ChangeIntensityTime time.Time `json:"change_intensity_time"`
+	LastHighLoadRatio   float64   `json:"last_high_load_ratio"`
+	// RecordThresholds和RecordCounters是计数器记录器的阈值和对应的计数器读数
+	RecordThresholds []float64 `json:"record_thresholds"`
+	RecordCounters   []int     `json:"record_counters"`
+}
+
+// snapshotRecorder 可以保存到快照以及从快照恢复的记录器，目前只有计数器记录器，
+// 其他记录器的状态没有办法保存，不能和快照一起使用
+type snapshotRecorder interface {
+	// snapshot 获取记录器的阈值和对应的计数器读数
+	snapshot() (thresholds []float64, counters []int)
+	// restoreSnapshot 恢复阈值对应的计数器读数，返回恢复成功的阈值
+	restoreSnapshot(thresholds []float64, counters []int) []float64
+}
+
+func (r *cpusageRecorder) snapshot() ([]float64, []int) {
+	return append([]float64(nil), r.thresholds...), append([]int(nil), r.recordCounters...)
+}
+
+// restoreSnapshot 只恢复当前记录器中存在的阈值，计数器读数不超过当前的上限
+func (r *cpusageRecorder) restoreSnapshot(thresholds []float64, counters []int) []float64 {
+	var restored []float64
+	recordCap := r.getRecordCap()
+	for i, threshold := range thresholds {
+		for j := range r.thresholds {
+			if r.thresholds[j] != threshold {
+				continue
+			}
+			counter := counters[i]
+			if counter > recordCap {
+				counter = recordCap
+			}
+			if counter > 0 {
+				r.recordCounters[j] = counter
+			}
+			restored = append(restored, threshold)
+		}
+	}
+	return restored
+}
+
+// planSnapshotter 负责保存和恢复massagePlan的状态快照
+type planSnapshotter struct {
+	// snapshotFile 快照文件的路径
+	snapshotFile string
+	// maxAge 快照的有效期，启动时只恢复保存时间在有效期内的快照
+	maxAge time.Duration
+	// saveInterval 定期保存快照的间隔，为0则只在Stop的时候保存
+	saveInterval time.Duration
+
+	lastSaveTime time.Time
+	now          func() time.Time
+}
+
+func newPlanSnapshotter(snapshotFile string, maxAge, saveInterval time.Duration) *planSnapshotter {
+	return &planSnapshotter{
+		snapshotFile: snapshotFile,
+		maxAge:       maxAge,
+		saveInterval: saveInterval,
+		now:          time.Now,
+	}
+}
+
+// isValid 用来判断快照参数是否合法
+func (s *planSnapshotter) isValid() error {
+	if s.snapshotFile == "" {
+		return fmt.Errorf("snapshotFile should not be empty")
+	}
+	if s.maxAge <= 0 {
+		return fmt.Errorf("maxAge should greater than 0")
+	}
+	if s.saveInterval < 0 {
+		return fmt.Errorf("saveInterval should not less than 0")
+	}
+	return nil
+}
+
+// isValidWith 用来判断快照能否和其他选项一起使用，快照只保存计数器记录器以及疲累状态的
+// 按摩力度，自定义的记录器、控制策略和负荷等级的状态没有办法保存和恢复
+func (s *planSnapshotter) isValidWith(o *options) error {
+	if o.recorder != nil {
+		if _, ok := o.recorder.(snapshotRecorder); !ok {
+			return fmt.Errorf("snapshot only supports the counter recorder")
+		}
+	}
+	if _, ok := o.strategy.(stateMachineStrategy); (o.strategy != nil && !ok) || len(o.loadLevels) > 0 {
+		return fmt.Errorf("snapshot should not be used with strategy or loadLevels")
+	}
+	return nil
+}
+
+// needPeriodicSave 距离上次保存是否已经超过了定期保存快照的间隔
+func (s *planSnapshotter) needPeriodicSave(now time.Time) bool {
+	if s.saveInterval <= 0 {
+		return false
+	}
+	if s.lastSaveTime.IsZero() {
+		s.lastSaveTime = now
+		return false
+	}
+	return now.Sub(s.lastSaveTime) >= s.saveInterval
+}
+
+// take 获取massagePlan当前的状态快照
+func (s *planSnapshotter) take(p *massagePlan) *planSnapshot {
+	snapshot := &planSnapshot{
+		SaveTime:            s.now(),
+		Tired:               p.isTired(),
+		CurrentIntensity:    p.currentIntensity,
+		ChangeIntensityTime: p.changeIntensityTime,
+		LastHighLoadRatio:   p.lastHighLoadRatio,
+	}
+	if recorder, ok := p.getRecorder().(snapshotRecorder); ok {
+		snapshot.RecordThresholds, snapshot.RecordCounters = recorder.snapshot()
+	}
+	return snapshot
+}
+
+// save 把massagePlan当前的状态快照写入快照文件，先写临时文件再改名，避免写到一半的快照被读取，
+// 快照在controlMu的保护下获取，避免和人工干预同时修改状态，写文件的时候不持有controlMu
+func (s *planSnapshotter) save(p *massagePlan) error {
+	p.controlMu.Lock()
+	snapshot := s.take(p)
+	p.controlMu.Unlock()
+	content, err := json.Marshal(snapshot)
+	if err != nil {
+		return fmt.Errorf("json.Marshal error:%s", err.Error())
+	}
+	tmpFile, err := ioutil.TempFile(filepath.Dir(s.snapshotFile), filepath.Base(s.snapshotFile)+".tmp")
+	if err != nil {
+		return fmt.Errorf("create temp file error:%s", err.Error())
+	}
+	defer os.Remove(tmpFile.Name())
+	if _, err := tmpFile.Write(content); err != nil {
+		tmpFile.Close()
+		return fmt.Errorf("write temp file error:%s", err.Error())
+	}
+	if err := tmpFile.Close(); err != nil {
+		return fmt.Errorf("close temp file error:%s", err.Error())
+	}
+	if err := os.Rename(tmpFile.Name(), s.snapshotFile); err != nil {
+		return fmt.Errorf("rename temp file error:%s", err.Error())
+	}
+	s.lastSaveTime = snapshot.SaveTime
+	return nil
+}
+
+// restore 从快照文件恢复massagePlan的状态，快照过期的话不恢复
+func (s *planSnapshotter) restore(p *massagePlan) error {
+	content, err := ioutil.ReadFile(s.snapshotFile)
+	if err != nil {
+		return fmt.Errorf("ReadFile:%s, error:%s", s.snapshotFile, err.Error())
+	}
+	var snapshot planSnapshot
+	if err := json.Unmarshal(content, &snapshot); err != nil {
+		return fmt.Errorf("json.Unmarshal error:%s", err.Error())
+	}
+	if age := s.now().Sub(snapshot.SaveTime); age < 0 || age > s.maxAge {
+		return fmt.Errorf("snapshot saved at:%v is out of date", snapshot.SaveTime)
+	}
+	if len(snapshot.RecordThresholds) != len(snapshot.RecordCounters) {
+		return fmt.Errorf("record thresholds and counters mismatch")
+	}
+	if snapshot.CurrentIntensity > fullIntensity {
+		return fmt.Errorf("invalid intensity:%d", snapshot.CurrentIntensity)
+	}
+
+	recorder, ok := p.getRecorder().(snapshotRecorder)
+	if !ok {
+		return fmt.Errorf("recorder does not support snapshot")
+	}
+	restored := recorder.restoreSnapshot(snapshot.RecordThresholds, snapshot.RecordCounters)
+	// 高负荷阈值的计数器没有恢复的话，疲累状态的按摩力度和高负荷占比都和记录器对不上，不恢复
+	highLoadRestored := false
+	for _, threshold := range restored {
+		if threshold == p.opts.getHighLoadThreshold() {
+			highLoadRestored = true
+		}
+	}
+	if snapshot.Tired && highLoadRestored {
+		p.SetTired()
+		p.currentIntensity = snapshot.CurrentIntensity
+		p.changeIntensityTime = snapshot.ChangeIntensityTime
+		p.lastHighLoadRatio = snapshot.LastHighLoadRatio
+	}
+	return nil
+}
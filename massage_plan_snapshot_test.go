@@ -0,0 +1,175 @@
+package cpumassager
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPlanSnapshotSaveAndRestore(t *testing.T) {
+	require := require.New(t)
+	dir, err := ioutil.TempDir("", "cpumassager")
+	require.Nil(err)
+	defer os.RemoveAll(dir)
+	snapshotFile := filepath.Join(dir, "plan.snapshot")
+
+	opts := options{highLoadThreshold: 85, loadStatusJudgeRatio: 0.2, initialIntensity: 50}
+	mp := massagePlan{opts: opts, currentState: stateRelaxed{}}
+	mp.cpusageRecorder = newCPUsageRecorder([]float64{85}, 0)
+	for i := 0; i < 30; i++ {
+		mp.cpusageRecorder.AddRecord(90)
+	}
+	mp.updateCurTime()
+	mp.SetTired()
+	mp.currentIntensity = 70
+
+	snapshotter := newPlanSnapshotter(snapshotFile, time.Minute, 0)
+	require.Nil(snapshotter.isValid())
+	require.Nil(snapshotter.save(&mp))
+
+	restored := massagePlan{opts: opts, currentState: stateRelaxed{}, currentIntensity: 50}
+	restored.cpusageRecorder = newCPUsageRecorder([]float64{85}, 0)
+	require.Nil(snapshotter.restore(&restored))
+	require.True(restored.isTired())
+	require.Equal(uint(70), restored.currentIntensity)
+	require.True(mp.changeIntensityTime.Equal(restored.changeIntensityTime))
+	require.Equal(mp.lastHighLoadRatio, restored.lastHighLoadRatio)
+	require.Equal(30, restored.cpusageRecorder.GetRecordNumOfThreshold(85))
+	require.Equal(30, restored.cpusageRecorder.GetRecordNumOfCounterType(CounterTypeEighty))
+
+	// 计数器读数不超过当前记录器的上限，当前记录器中不存在的阈值不恢复
+	restored = massagePlan{opts: opts, currentState: stateRelaxed{}}
+	restored.cpusageRecorder = newCPUsageRecorder(nil, 20)
+	require.Nil(snapshotter.restore(&restored))
+	require.Equal(20, restored.cpusageRecorder.GetRecordNumOfCounterType(CounterTypeEighty))
+	require.Equal(0, restored.cpusageRecorder.GetRecordNumOfThreshold(85))
+	// 高负荷阈值的计数器没有恢复，不恢复疲累状态
+	require.True(restored.isRelaxed())
+
+	// 使用WithRecorder设定的计数器记录器也可以保存和恢复
+	recorderOpts := opts
+	recorderOpts.recorder = NewCounterRecorder(100, 85)
+	restored = massagePlan{opts: recorderOpts, currentState: stateRelaxed{}}
+	require.Nil(snapshotter.restore(&restored))
+	require.True(restored.isTired())
+	require.Equal(0.3, restored.getHighLoadRatio())
+	require.Equal(0, restored.cpusageRecorder.GetRecordNumOfThreshold(85))
+
+	// 过期的快照不恢复
+	snapshotter.now = func() time.Time { return time.Now().Add(2 * time.Minute) }
+	restored = massagePlan{opts: opts, currentState: stateRelaxed{}}
+	require.NotNil(snapshotter.restore(&restored))
+	require.True(restored.isRelaxed())
+
+	require.NotNil(newPlanSnapshotter(filepath.Join(dir, "not-exist"), time.Minute, 0).restore(&restored))
+	require.NotNil(newPlanSnapshotter("", time.Minute, 0).isValid())
+	require.NotNil(newPlanSnapshotter(snapshotFile, 0, 0).isValid())
+	require.NotNil(newPlanSnapshotter(snapshotFile, time.Minute, -1).isValid())
+}
+
+func TestPlanSnapshotIsValidWith(t *testing.T) {
+	require := require.New(t)
+	opts := options{
+		cpusageCollector:     collectorFunc(func() float64 { return 0 }),
+		loadStatusJudgeRatio: 0.2,
+	}
+	WithSnapshot("plan.snapshot", time.Minute, 0)(&opts)
+	require.True(opts.isValid())
+	WithRecorder(NewCounterRecorder(20))(&opts)
+	require.True(opts.isValid())
+
+	// 自定义的记录器、控制策略和负荷等级的状态没有办法保存
+	ewmaRecorder, err := NewEWMARecorder(0.05)
+	require.Nil(err)
+	invalid := opts
+	WithRecorder(ewmaRecorder)(&invalid)
+	require.False(invalid.isValid())
+	invalid = opts
+	WithLoadLevels(DefaultLoadLevels()...)(&invalid)
+	require.False(invalid.isValid())
+	invalid = opts
+	WithStrategy(newPIDStrategy(70, 1, 0, 0))(&invalid)
+	require.False(invalid.isValid())
+}
+
+func TestPlanSnapshotNeedPeriodicSave(t *testing.T) {
+	require := require.New(t)
+	now := time.Now()
+	require.False(newPlanSnapshotter("plan.snapshot", time.Minute, 0).needPeriodicSave(now))
+
+	snapshotter := newPlanSnapshotter("plan.snapshot", time.Minute, 10*time.Second)
+	require.False(snapshotter.needPeriodicSave(now))
+	require.False(snapshotter.needPeriodicSave(now.Add(9 * time.Second)))
+	require.True(snapshotter.needPeriodicSave(now.Add(10 * time.Second)))
+}
+
+func TestStartAndStopWithSnapshot(t *testing.T) {
+	require := require.New(t)
+	mockCtl := gomock.NewController(t)
+	defer mockCtl.Finish()
+	mockCollector := NewMockCPUsageCollector(mockCtl)
+	mockCollector.EXPECT().GetCPUsage().Return(90.0).AnyTimes()
+
+	dir, err := ioutil.TempDir("", "cpumassager")
+	require.Nil(err)
+	defer os.RemoveAll(dir)
+	snapshotFile := filepath.Join(dir, "plan.snapshot")
+
+	opts := options{
+		cpusageCollector:     mockCollector,
+		highLoadLevel:        CounterTypeEighty,
+		loadStatusJudgeRatio: 0.2,
+		initialIntensity:     50,
+		stepIntensity:        1,
+		checkPeriodInSeconds: 3,
+	}
+	WithSnapshot(snapshotFile, time.Minute, 0)(&opts)
+	mp := &massagePlan{currentState: stateRelaxed{}}
+	require.NotNil(mp.Stop())
+	require.Nil(mp.Start(opts))
+	require.NotNil(mp.Start(opts))
+	require.Nil(mp.Stop())
+	require.False(mp.isStarted)
+	_, err = os.Stat(snapshotFile)
+	require.Nil(err)
+
+	// 重启之后从快照恢复计数器读数
+	mp = &massagePlan{currentState: stateRelaxed{}}
+	require.Nil(mp.Start(opts))
+	require.Nil(mp.Stop())
+	require.Equal(2, mp.cpusageRecorder.GetRecordNumOfCounterType(CounterTypeEighty))
+}
+
+func TestPlanSnapshotSaveWithOverride(t *testing.T) {
+	require := require.New(t)
+	dir, err := ioutil.TempDir("", "cpumassager")
+	require.Nil(err)
+	defer os.RemoveAll(dir)
+
+	opts := options{highLoadThreshold: 85, loadStatusJudgeRatio: 0.2, initialIntensity: 50}
+	mp := massagePlan{opts: opts, currentState: stateRelaxed{}}
+	mp.cpusageRecorder = newCPUsageRecorder([]float64{85}, 0)
+	snapshotter := newPlanSnapshotter(filepath.Join(dir, "plan.snapshot"), time.Minute, 0)
+
+	// 保存快照的同时人工干预修改状态，快照在controlMu的保护下获取，不会有数据竞争
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			mode := OverrideModeTired
+			if i%2 == 1 {
+				mode = OverrideModeRelaxed
+			}
+			_ = mp.Override(mode, 80, time.Minute)
+		}
+	}()
+	for i := 0; i < 20; i++ {
+		require.Nil(snapshotter.save(&mp))
+	}
+	<-done
+}
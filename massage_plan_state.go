@@ -23,9 +23,16 @@ func (s stateTired) AddACPUsageRecord(p *massagePlan) {
 		return
 	}
 
-	if p.IsHighLoadCountIncreased() {
-		p.IncreaseIntensity()
-	} else {
+	// 提高和降低按摩力度的检查周期可以不同，需要分别判断，只有真正调整了按摩力度才更新
+	// 高负荷占比的基准，保证比较的是上次调整按摩力度时的高负荷占比
+	curHighLoadRatio := p.getHighLoadRatio()
+	if p.isHighLoadRatioIncreased(curHighLoadRatio) {
+		if p.isChangeDurationExceed(p.opts.getIncreaseCheckPeriod()) {
+			p.IncreaseIntensity()
+			p.lastHighLoadRatio = curHighLoadRatio
+		}
+	} else if p.isChangeDurationExceed(p.opts.getDecreaseCheckPeriod()) {
 		p.DecreaseIntensity()
+		p.lastHighLoadRatio = curHighLoadRatio
 	}
 }
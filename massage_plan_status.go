@@ -0,0 +1,40 @@
+package cpumassager
+
+import "time"
+
+// MassageStatus 按摩计划的当前状态，用于展示和排查问题
+type MassageStatus struct {
+	// LoadLevel 当前的负荷等级，和CurrentLoadLevel一致
+	LoadLevel string
+	// Tired 是否处于疲累状态
+	Tired bool
+	// Intensity 当前实际生效的按摩力度，包括慢启动等按摩力度爬坡
+	Intensity uint
+	// DryRun 是否处于试运行模式
+	DryRun bool
+	// Draining 是否正在排空或者已经排空
+	Draining bool
+	// Override 人工干预的状态，没有人工干预则为nil
+	Override *OverrideStatus
+	// RejectStats 拒绝服务的统计
+	RejectStats RejectStats
+}
+
+// GetMassageStatus 获取按摩计划的当前状态
+func (p *massagePlan) GetMassageStatus() MassageStatus {
+	p.controlMu.Lock()
+	defer p.controlMu.Unlock()
+	status := MassageStatus{
+		LoadLevel:   p.CurrentLoadLevel(),
+		Tired:       p.isTired(),
+		DryRun:      p.isDryRun(),
+		Draining:    p.getDrain() != nil,
+		RejectStats: p.GetRejectStats(),
+	}
+	status.Intensity = p.getIntensity()
+	if p.isOverridden(time.Now()) {
+		override := *p.override
+		status.Override = &override
+	}
+	return status
+}
@@ -0,0 +1,112 @@
+package cpumassager
+
+import "time"
+
+// StrategyContext 提供给控制策略的massagePlan上下文
+type StrategyContext interface {
+	// Now 获取本次CPU使用率的采集时间
+	Now() time.Time
+	// Recorder 获取massagePlan使用的CPU使用率记录器，本次的记录已经添加到记录器中
+	Recorder() Recorder
+	// HighLoadThreshold 获取massagePlan的高负荷阈值
+	HighLoadThreshold() float64
+	// CurrentIntensity 获取当前的按摩力度
+	CurrentIntensity() uint
+	// IsTired 当前是否处于疲累状态
+	IsTired() bool
+}
+
+// Strategy 控制策略，每采集一条CPU使用率记录就调用一次，返回目标按摩力度，取值范围是
+// [0, 100]：返回0则进入轻松状态不拒绝服务，返回大于0的值则进入疲累状态并以该按摩力度拒绝服务，
+// 默认的控制策略是DefaultStrategy返回的轻松/疲累状态机
+// Strategy只会在massagePlan收集CPU使用率的routine中被调用，不需要考虑并发
+type Strategy interface {
+	NextIntensity(cpusage float64, ctx StrategyContext) uint
+}
+
+// stateMachineStrategy 默认的控制策略，也就是轻松/疲累状态机，状态保存在massagePlan中
+type stateMachineStrategy struct{}
+
+// DefaultStrategy 获取默认的控制策略，也就是轻松/疲累状态机：轻松状态下高负荷占比超过
+// loadStatusJudgeRatio就进入疲累状态，疲累状态下每个检查周期按照高负荷占比的变化步进地
+// 提高或者降低按摩力度，降到0之后回到轻松状态。可以在自定义的Strategy中调用它再调整
+// 其返回的按摩力度，例如限制按摩力度的上限。状态机的状态保存在massagePlan中，所以只能
+// 使用massagePlan传入的ctx调用，其他的ctx会原样返回当前的按摩力度
+func DefaultStrategy() Strategy {
+	return stateMachineStrategy{}
+}
+
+func (s stateMachineStrategy) NextIntensity(cpusage float64, ctx StrategyContext) uint {
+	c, ok := ctx.(strategyContext)
+	if !ok {
+		return ctx.CurrentIntensity()
+	}
+	c.p.currentState.AddACPUsageRecord(c.p)
+	return c.CurrentIntensity()
+}
+
+// strategyContext 用massagePlan实现的StrategyContext
+type strategyContext struct {
+	p *massagePlan
+}
+
+func (c strategyContext) Now() time.Time {
+	return c.p.currentCPUsageRecordTime
+}
+
+func (c strategyContext) Recorder() Recorder {
+	return c.p.getRecorder()
+}
+
+func (c strategyContext) HighLoadThreshold() float64 {
+	return c.p.opts.getHighLoadThreshold()
+}
+
+func (c strategyContext) CurrentIntensity() uint {
+	if c.p.isRelaxed() {
+		return emptyIntensity
+	}
+	return c.p.currentIntensity
+}
+
+func (c strategyContext) IsTired() bool {
+	return c.p.isTired()
+}
+
+// getStrategy 获取massagePlan使用的控制策略，没有设定则使用默认的状态机
+func (p *massagePlan) getStrategy() Strategy {
+	if p.opts.strategy != nil {
+		return p.opts.strategy
+	}
+	return DefaultStrategy()
+}
+
+// runStrategy 运行控制策略并应用目标按摩力度，目标按摩力度和当前的一致则不需要调整，
+// 默认的状态机在疲累状态下可能暂时保持为0的按摩力度，不能因此就回到轻松状态
+func (p *massagePlan) runStrategy(cpusage float64) {
+	ctx := strategyContext{p}
+	if intensity := p.getStrategy().NextIntensity(cpusage, ctx); intensity != ctx.CurrentIntensity() {
+		p.applyIntensity(intensity)
+	}
+}
+
+// applyIntensity 应用控制策略给出的目标按摩力度，按需扭转massagePlan的状态
+func (p *massagePlan) applyIntensity(intensity uint) {
+	if intensity > fullIntensity {
+		intensity = fullIntensity
+	}
+	if intensity == emptyIntensity {
+		if p.isTired() {
+			p.SetRelaxed()
+		}
+		return
+	}
+	if p.isRelaxed() {
+		p.SetTired()
+	}
+	if intensity != p.currentIntensity {
+		p.currentIntensity = intensity
+		p.UpdateChangeIntensityTime()
+		p.clearWorkspace()
+	}
+}
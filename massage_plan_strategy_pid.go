@@ -0,0 +1,85 @@
+package cpumassager
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// pidStrategy PID控制策略，以目标CPU使用率为设定值，根据CPU使用率和设定值的偏差，
+// 用比例、积分、微分三项连续地调整按摩力度，避免固定步进调整带来的超调和振荡
+type pidStrategy struct {
+	// setpoint 目标CPU使用率，例如75
+	setpoint float64
+	kp       float64
+	ki       float64
+	kd       float64
+
+	// integral 偏差对时间的积分，以"百分比*秒"为单位
+	integral  float64
+	lastError float64
+	lastTime  time.Time
+}
+
+func newPIDStrategy(setpoint, kp, ki, kd float64) *pidStrategy {
+	return &pidStrategy{setpoint: setpoint, kp: kp, ki: ki, kd: kd}
+}
+
+// isValid 用来判断PID控制策略的参数是否合法
+func (s *pidStrategy) isValid() error {
+	if s.setpoint <= 0 || s.setpoint >= 100 {
+		return fmt.Errorf("setpoint should in (0, 100), 75 is recommended")
+	}
+	if s.kp < 0 || s.ki < 0 || s.kd < 0 {
+		return fmt.Errorf("kp, ki and kd should not less than 0")
+	}
+	if s.kp == 0 && s.ki == 0 {
+		return fmt.Errorf("kp and ki should not both be 0")
+	}
+	return nil
+}
+
+// output 计算PID的输出
+func (s *pidStrategy) output(e, integral, derivative float64) float64 {
+	return s.kp*e + s.ki*integral + s.kd*derivative
+}
+
+func (s *pidStrategy) NextIntensity(cpusage float64, ctx StrategyContext) uint {
+	// 无效的CPU使用率会让积分项一直是NaN，直接保持当前的按摩力度
+	if math.IsNaN(cpusage) || math.IsInf(cpusage, 0) {
+		return ctx.CurrentIntensity()
+	}
+	now := ctx.Now()
+	// CPU使用率超过设定值的时候偏差为正，需要提高按摩力度
+	e := cpusage - s.setpoint
+	dt := 0.0
+	if !s.lastTime.IsZero() {
+		dt = now.Sub(s.lastTime).Seconds()
+	}
+	derivative := 0.0
+	if dt > 0 {
+		derivative = (e - s.lastError) / dt
+	}
+	s.lastError = e
+	s.lastTime = now
+
+	// 抗积分饱和：输出饱和的时候积分项只积累到刚好让输出饱和为止，
+	// 并且积分项本身被限制在[0, 100]的输出范围内
+	if s.ki <= 0 {
+		s.integral = 0
+	} else {
+		integral := s.integral + e*dt
+		proportionalAndDerivative := s.kp*e + s.kd*derivative
+		out := proportionalAndDerivative + s.ki*integral
+		if out > fullIntensity && e > 0 {
+			integral = math.Max(s.integral, (fullIntensity-proportionalAndDerivative)/s.ki)
+		} else if out < emptyIntensity && e < 0 {
+			integral = math.Min(s.integral, (emptyIntensity-proportionalAndDerivative)/s.ki)
+		}
+		s.integral = math.Max(emptyIntensity, math.Min(fullIntensity/s.ki, integral))
+	}
+
+	out := s.output(e, s.integral, derivative)
+	out = math.Max(emptyIntensity, math.Min(fullIntensity, out))
+	return uint(math.Round(out))
+}
@@ -0,0 +1,104 @@
+package cpumassager
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fakeStrategyContext 使用模拟时钟的StrategyContext
+type fakeStrategyContext struct {
+	now       time.Time
+	intensity uint
+}
+
+func (c *fakeStrategyContext) Now() time.Time             { return c.now }
+func (c *fakeStrategyContext) Recorder() Recorder         { return nil }
+func (c *fakeStrategyContext) HighLoadThreshold() float64 { return 80 }
+func (c *fakeStrategyContext) CurrentIntensity() uint     { return c.intensity }
+func (c *fakeStrategyContext) IsTired() bool              { return false }
+
+func TestPIDStrategyIsValid(t *testing.T) {
+	require := require.New(t)
+	require.Nil(newPIDStrategy(75, 2, 0.5, 0).isValid())
+	require.NotNil(newPIDStrategy(0, 2, 0.5, 0).isValid())
+	require.NotNil(newPIDStrategy(100, 2, 0.5, 0).isValid())
+	require.NotNil(newPIDStrategy(75, -1, 0.5, 0).isValid())
+	require.NotNil(newPIDStrategy(75, 0, 0, 1).isValid())
+
+	opts := &options{cpusageCollector: collectorFunc(func() float64 { return 0 }), loadStatusJudgeRatio: 0.2}
+	WithPIDController(75, 2, 0.5, 0.1)(opts)
+	require.True(opts.isValid())
+	WithPIDController(120, 2, 0.5, 0.1)(opts)
+	require.False(opts.isValid())
+}
+
+func TestPIDStrategy(t *testing.T) {
+	require := require.New(t)
+	ctx := &fakeStrategyContext{now: time.Now()}
+	next := func(s *pidStrategy, cpusage float64) uint {
+		ctx.now = ctx.now.Add(time.Second)
+		return s.NextIntensity(cpusage, ctx)
+	}
+
+	// 纯比例控制：偏差10，增益5，按摩力度50
+	s := newPIDStrategy(75, 5, 0, 0)
+	require.Equal(uint(50), next(s, 85))
+	// 低于设定值的时候按摩力度为0
+	require.Equal(uint(0), next(s, 50))
+	// 输出被限制在100以内
+	require.Equal(uint(100), next(s, 100))
+
+	// 积分控制：持续偏差10，每秒积分增加10
+	s = newPIDStrategy(75, 0, 1, 0)
+	require.Equal(uint(0), next(s, 85))
+	require.Equal(uint(10), next(s, 85))
+	require.Equal(uint(20), next(s, 85))
+
+	// 抗积分饱和：长时间过载之后积分不会无限增长，负荷下降后可以很快降低按摩力度
+	for i := 0; i < 100; i++ {
+		next(s, 100)
+	}
+	require.Equal(uint(100), next(s, 100))
+	require.InDelta(100.0, s.integral, 1e-9)
+	require.Equal(uint(90), next(s, 65))
+
+	// 无效的CPU使用率保持当前的按摩力度，不影响积分项，之后的有效记录按照间隔的时长积分
+	s = newPIDStrategy(75, 0, 1, 0)
+	require.Equal(uint(0), next(s, 85))
+	require.Equal(uint(10), next(s, 85))
+	ctx.intensity = 10
+	require.Equal(uint(10), next(s, math.NaN()))
+	require.Equal(uint(10), next(s, math.Inf(1)))
+	require.Equal(uint(10), next(s, math.Inf(-1)))
+	require.InDelta(10.0, s.integral, 1e-9)
+	require.Equal(uint(50), next(s, 85))
+	ctx.intensity = 0
+
+	// 微分控制：CPU使用率快速上升时提前提高按摩力度
+	s = newPIDStrategy(75, 1, 0, 2)
+	require.Equal(uint(0), next(s, 70))
+	require.Equal(uint(25), next(s, 80))
+}
+
+func TestMassagePlanWithPIDController(t *testing.T) {
+	require := require.New(t)
+	cpusage := 95.0
+	mp := massagePlan{
+		opts: options{
+			cpusageCollector:     collectorFunc(func() float64 { return cpusage }),
+			loadStatusJudgeRatio: 0.2,
+		},
+		currentState: stateRelaxed{},
+	}
+	WithPIDController(75, 2, 0, 0)(&mp.opts)
+	mp.AddACPUsageRecord()
+	require.True(mp.isTired())
+	require.Equal(uint(40), mp.currentIntensity)
+
+	cpusage = 60
+	mp.AddACPUsageRecord()
+	require.True(mp.isRelaxed())
+}
@@ -0,0 +1,135 @@
+package cpumassager
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// scriptedStrategy 按照事先设定的序列返回目标按摩力度，并记录收到的上下文
+type scriptedStrategy struct {
+	intensities []uint
+	cpusages    []float64
+	tired       []bool
+	current     []uint
+}
+
+func (s *scriptedStrategy) NextIntensity(cpusage float64, ctx StrategyContext) uint {
+	s.cpusages = append(s.cpusages, cpusage)
+	s.tired = append(s.tired, ctx.IsTired())
+	s.current = append(s.current, ctx.CurrentIntensity())
+	intensity := s.intensities[0]
+	s.intensities = s.intensities[1:]
+	return intensity
+}
+
+func TestMassagePlanWithStrategy(t *testing.T) {
+	require := require.New(t)
+	strategy := &scriptedStrategy{intensities: []uint{0, 30, 30, 120, 0}}
+	cpusage := 10.0
+	mp := massagePlan{
+		opts: options{
+			cpusageCollector:     collectorFunc(func() float64 { cpusage += 10; return cpusage }),
+			highLoadThreshold:    85,
+			loadStatusJudgeRatio: 0.2,
+			initialIntensity:     50,
+		},
+		currentState: stateRelaxed{},
+	}
+	WithStrategy(strategy)(&mp.opts)
+	require.True(mp.opts.isValid())
+
+	mp.AddACPUsageRecord()
+	require.True(mp.isRelaxed())
+	require.False(mp.NeedMassage())
+
+	mp.AddACPUsageRecord()
+	require.True(mp.isTired())
+	require.Equal(uint(30), mp.currentIntensity)
+	require.Equal(strategyContext{&mp}.Now(), mp.changeIntensityTime)
+
+	// 按摩力度不变的时候不重置工作区
+	mp.NeedMassage()
+	mp.AddACPUsageRecord()
+	require.Equal(uint64(1), mp.todoTaskNum())
+
+	// 超过100的按摩力度按100处理
+	mp.AddACPUsageRecord()
+	require.Equal(uint(fullIntensity), mp.currentIntensity)
+	require.True(mp.NeedMassage())
+
+	mp.AddACPUsageRecord()
+	require.True(mp.isRelaxed())
+	require.False(mp.NeedMassage())
+
+	require.Equal([]float64{20, 30, 40, 50, 60}, strategy.cpusages)
+	require.Equal([]bool{false, false, true, true, true}, strategy.tired)
+	require.Equal([]uint{0, 0, 30, 30, 100}, strategy.current)
+	require.Equal(85.0, strategyContext{&mp}.HighLoadThreshold())
+	require.Equal(Recorder(&mp.cpusageRecorder), strategyContext{&mp}.Recorder())
+}
+
+// cappedStrategy 在默认状态机的基础上限制按摩力度的上限
+type cappedStrategy struct {
+	maxIntensity uint
+}
+
+func (s cappedStrategy) NextIntensity(cpusage float64, ctx StrategyContext) uint {
+	intensity := DefaultStrategy().NextIntensity(cpusage, ctx)
+	if intensity > s.maxIntensity {
+		return s.maxIntensity
+	}
+	return intensity
+}
+
+func TestDefaultStrategy(t *testing.T) {
+	require := require.New(t)
+	newPlan := func(strategy Strategy) *massagePlan {
+		mp := &massagePlan{
+			opts: options{
+				cpusageCollector:     collectorFunc(func() float64 { return 90 }),
+				highLoadThreshold:    80,
+				loadStatusJudgeRatio: 0.2,
+				initialIntensity:     50,
+				stepIntensity:        10,
+				recorder:             NewCounterRecorder(10),
+				strategy:             strategy,
+			},
+			currentState: stateRelaxed{},
+		}
+		require.True(mp.opts.isValid())
+		return mp
+	}
+
+	// 显式设定DefaultStrategy和不设定控制策略的效果一致
+	implicit, explicit := newPlan(nil), newPlan(DefaultStrategy())
+	for i := 0; i < 20; i++ {
+		implicit.AddACPUsageRecord()
+		explicit.AddACPUsageRecord()
+		require.Equal(implicit.isTired(), explicit.isTired())
+		require.Equal(implicit.currentIntensity, explicit.currentIntensity)
+	}
+	require.True(implicit.isTired())
+
+	// 组合默认的状态机，限制按摩力度的上限
+	capped := newPlan(cappedStrategy{maxIntensity: 60})
+	for i := 0; i < 20; i++ {
+		capped.AddACPUsageRecord()
+		require.True(capped.currentIntensity <= 60)
+	}
+	require.True(capped.isTired())
+	require.Equal(uint(60), capped.currentIntensity)
+
+	// 不是massagePlan传入的ctx原样返回当前的按摩力度
+	require.Equal(uint(60), DefaultStrategy().NextIntensity(90, fixedStrategyContext{intensity: 60}))
+}
+
+// fixedStrategyContext 返回固定按摩力度的上下文
+type fixedStrategyContext struct {
+	StrategyContext
+	intensity uint
+}
+
+func (c fixedStrategyContext) CurrentIntensity() uint {
+	return c.intensity
+}
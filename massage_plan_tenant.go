@@ -0,0 +1,123 @@
+package cpumassager
+
+import (
+	"hash/fnv"
+	"math"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	// tenantSketchDepth、tenantSketchWidth count-min sketch的行数和每行的计数器个数
+	tenantSketchDepth = 4
+	tenantSketchWidth = 2048
+	// tenantBitmapSize 用线性计数法估算key的个数时使用的位图大小
+	tenantBitmapSize = 4096
+)
+
+// tenantTracker 以有限的内存按key统计已处理的任务数，用count-min sketch估算每个key
+// 已处理的任务数，用线性计数法估算key的个数，零值可以直接使用
+type tenantTracker struct {
+	mu     sync.Mutex
+	sketch [tenantSketchDepth][tenantSketchWidth]uint32
+	bitmap [tenantBitmapSize / 64]uint64
+	// setBits 位图中已经置位的个数
+	setBits int
+}
+
+// reset 清空统计，在按摩计划清空工作区的时候调用
+func (t *tenantTracker) reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.sketch = [tenantSketchDepth][tenantSketchWidth]uint32{}
+	t.bitmap = [tenantBitmapSize / 64]uint64{}
+	t.setBits = 0
+}
+
+// hash 计算key的两个哈希值，用来按照双重哈希定位sketch中每一行的计数器
+func (t *tenantTracker) hash(key string) (uint32, uint32) {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(key))
+	sum := h.Sum64()
+	return uint32(sum), uint32(sum>>32) | 1
+}
+
+// observe 记录出现了一次key，返回key已处理任务数的估计值和key个数的估计值
+func (t *tenantTracker) observe(key string) (doneTasks uint32, keys float64) {
+	h1, h2 := t.hash(key)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	bit := h1 % tenantBitmapSize
+	if t.bitmap[bit/64]&(1<<(bit%64)) == 0 {
+		t.bitmap[bit/64] |= 1 << (bit % 64)
+		t.setBits++
+	}
+	doneTasks = math.MaxUint32
+	for i := uint32(0); i < tenantSketchDepth; i++ {
+		if c := t.sketch[i][(h1+i*h2)%tenantSketchWidth]; c < doneTasks {
+			doneTasks = c
+		}
+	}
+	return doneTasks, t.estimateKeys()
+}
+
+// estimateKeys 用线性计数法估算key的个数，位图满了的时候按照饱和值估算
+func (t *tenantTracker) estimateKeys() float64 {
+	zeroBits := math.Max(1, float64(tenantBitmapSize-t.setBits))
+	return float64(tenantBitmapSize) * math.Log(tenantBitmapSize/zeroBits)
+}
+
+// finish 记录key处理了一个任务
+func (t *tenantTracker) finish(key string) {
+	h1, h2 := t.hash(key)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for i := uint32(0); i < tenantSketchDepth; i++ {
+		t.sketch[i][(h1+i*h2)%tenantSketchWidth]++
+	}
+}
+
+// getTenantWeight 获取key的权重，没有设定则为1
+func (p *massagePlan) getTenantWeight(key string) float64 {
+	if weight, ok := p.opts.tenantWeights[key]; ok {
+		return weight
+	}
+	return 1
+}
+
+// canDoWorkInTiredFor 疲累状态下按照key的公平份额判断是否可以处理：按照按摩力度
+// 算出需要完成的任务数，已处理的任务数达到需要完成的任务数就拒绝；没有达到的话，
+// 按照key的个数和权重均分得到每个key的公平份额，key已处理的任务数不超过公平份额就处理，
+// 超过公平份额的key只能使用为没有超过公平份额的key预留之后剩下的余量，预留的余量是
+// 这些key的待处理任务数，但是至少给当前key留出它自己的公平份额
+func (p *massagePlan) canDoWorkInTiredFor(key string, intensity uint) bool {
+	todoTasks := atomic.AddUint64(&p.tenantTodoTasks, 1)
+	requireTasks := todoTasks * (fullIntensity - uint64(intensity)) / fullIntensity
+	// 先记录key再判断余量，被拒绝的key也要计入key的个数，否则公平份额会被高估
+	doneTasks, keys := p.tenantTracker.observe(key)
+	share := float64(requireTasks) / math.Max(1, keys) * p.getTenantWeight(key)
+	overShare := float64(doneTasks) >= share
+	if !overShare {
+		atomic.AddUint64(&p.tenantUnderShareTodoTasks, 1)
+	}
+	if atomic.LoadUint64(&p.tenantDoneTasks) >= requireTasks {
+		return false
+	}
+	if overShare {
+		reserved := math.Min(float64(atomic.LoadUint64(&p.tenantUnderShareTodoTasks)), float64(requireTasks)-share)
+		if float64(atomic.LoadUint64(&p.tenantOverShareDoneTasks))+reserved >= float64(requireTasks) {
+			return false
+		}
+		atomic.AddUint64(&p.tenantOverShareDoneTasks, 1)
+	}
+	atomic.AddUint64(&p.tenantDoneTasks, 1)
+	p.tenantTracker.finish(key)
+	return true
+}
+
+// NeedMassageFor 和NeedMassage一样判断是否需要拒绝服务，但是会按照key(例如租户、调用方)
+// 公平地分配按摩力度，优先拒绝超过公平份额的key的请求
+func (p *massagePlan) NeedMassageFor(key string) bool {
+	intensity := p.getIntensity()
+	return p.finishDecision(intensity, intensity > emptyIntensity && !p.canDoWorkInTiredFor(key, intensity))
+}
@@ -0,0 +1,92 @@
+package cpumassager
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTenantTracker(t *testing.T) {
+	require := require.New(t)
+	var tracker tenantTracker
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("tenant-%d", i)
+		tracker.observe(key)
+		tracker.finish(key)
+	}
+	doneTasks, keys := tracker.observe("tenant-0")
+	require.Equal(uint32(1), doneTasks)
+	require.InDelta(100, keys, 5)
+	tracker.reset()
+	doneTasks, keys = tracker.observe("tenant-0")
+	require.Equal(uint32(0), doneTasks)
+	require.InDelta(1, keys, 0.1)
+}
+
+func TestNeedMassageFor(t *testing.T) {
+	require := require.New(t)
+	mp := massagePlan{
+		opts: options{
+			cpusageCollector:     collectorFunc(func() float64 { return 0 }),
+			loadStatusJudgeRatio: 0.2,
+			initialIntensity:     50,
+		},
+		currentState: stateRelaxed{},
+	}
+	require.False(mp.NeedMassageFor("noisy"))
+
+	// 超过公平份额的key被优先拒绝，请求量小的key继续得到服务
+	mp.SetTired()
+	rejected := map[string]int{}
+	for i := 0; i < 100; i++ {
+		for j := 0; j < 9; j++ {
+			if mp.NeedMassageFor("noisy") {
+				rejected["noisy"]++
+			}
+		}
+		if mp.NeedMassageFor(fmt.Sprintf("light-%d", i%10)) {
+			rejected["light"]++
+		}
+	}
+	require.Equal(0, rejected["light"])
+	// 拒绝全部落在超过公平份额的key上，为其他key预留的余量就是它们的待处理任务，不会多拒绝
+	require.InDelta(500, rejected["noisy"], 5)
+	// 和NeedMassage的计数互不影响
+	require.Equal(uint64(0), mp.todoTaskNum())
+	require.Equal(uint64(0), mp.doneTaskNum())
+
+	// key很多的时候每个key都没有超过公平份额，依然按照按摩力度拒绝服务
+	mp.SetTired()
+	rejectedKeys := 0
+	for i := 0; i < 1000; i++ {
+		if mp.NeedMassageFor(fmt.Sprintf("user-%d", i)) {
+			rejectedKeys++
+		}
+	}
+	require.Equal(500, rejectedKeys)
+
+	// 一个key占了绝大部分请求的时候，请求量小的key一直得到服务，其余的余量依然分给占用多的key
+	mp.SetTired()
+	admitted := map[string]int{}
+	for i := 0; i < 1000; i++ {
+		for j := 0; j < 9; j++ {
+			if !mp.NeedMassageFor("hog") {
+				admitted["hog"]++
+			}
+		}
+		if !mp.NeedMassageFor("light") {
+			admitted["light"]++
+		}
+	}
+	require.Equal(1000, admitted["light"])
+	require.True(admitted["hog"] >= 3950 && admitted["hog"] <= 4000, admitted["hog"])
+
+	// 权重高的key可以得到更多的公平份额
+	WithTenantWeights(map[string]float64{"paid": 4})(&mp.opts)
+	require.True(mp.opts.isValid())
+	require.Equal(4.0, mp.getTenantWeight("paid"))
+	require.Equal(1.0, mp.getTenantWeight("free"))
+	WithTenantWeights(map[string]float64{"paid": 0})(&mp.opts)
+	require.False(mp.opts.isValid())
+}
@@ -222,3 +222,133 @@ func TestCanDoWorkInTired(t *testing.T) {
 	require.Equal(uint64(100), mp.todoTaskNum())
 	require.Equal(uint64(40), mp.doneTaskNum())
 }
+
+func TestIsHighLoadWithThresholdAndRecordCap(t *testing.T) {
+	require := require.New(t)
+	mp := massagePlan{
+		opts: options{
+			highLoadThreshold:    85,
+			loadStatusJudgeRatio: 0.5,
+			recordCap:            20,
+		},
+	}
+	mp.cpusageRecorder = newCPUsageRecorder([]float64{mp.opts.getHighLoadThreshold()}, int(mp.opts.recordCap))
+	// 记录数超过20*0.5=10才算高负荷，低于85的记录不计入
+	for i := 0; i < 10; i++ {
+		mp.cpusageRecorder.AddRecord(86)
+		mp.cpusageRecorder.AddRecord(84)
+		mp.cpusageRecorder.AddRecord(86)
+	}
+	require.Equal(0.5, mp.getHighLoadRatio())
+	require.False(mp.IsHighLoad())
+	mp.cpusageRecorder.AddRecord(90)
+	require.True(mp.IsHighLoad())
+	for i := 0; i < 20; i++ {
+		mp.cpusageRecorder.AddRecord(90)
+	}
+	require.Equal(1.0, mp.getHighLoadRatio())
+	require.True(mp.isHighLoadRatioIncreased(mp.getHighLoadRatio()))
+}
+
+func TestMassagePlanWithRecorder(t *testing.T) {
+	require := require.New(t)
+	mockCtl := gomock.NewController(t)
+	defer mockCtl.Finish()
+	mockCollector := NewMockCPUsageCollector(mockCtl)
+	mockCollector.EXPECT().GetCPUsage().Return(90.0).AnyTimes()
+
+	recorder, err := NewSlidingWindowRecorder(10)
+	require.Nil(err)
+	mp := massagePlan{
+		opts: options{
+			cpusageCollector:     mockCollector,
+			recorder:             recorder,
+			highLoadThreshold:    85,
+			loadStatusJudgeRatio: 0.5,
+			initialIntensity:     50,
+			stepIntensity:        10,
+		},
+		currentState: stateRelaxed{},
+	}
+	// 高负荷占比按照滑动窗口的大小计算，一条高负荷的记录不会进入疲累状态
+	for i := 0; i < 5; i++ {
+		mp.AddACPUsageRecord()
+		require.True(mp.isRelaxed())
+	}
+	mp.AddACPUsageRecord()
+	require.True(mp.isTired())
+	require.Equal(0, mp.cpusageRecorder.GetRecordNumOfCounterType(CounterTypeEighty))
+
+	// 计数器记录器需要事先关注高负荷阈值，massagePlan启动的时候会告知
+	counterRecorder := NewCounterRecorder(20)
+	counterRecorder.AddRecord(90)
+	require.Equal(0.0, counterRecorder.GetLoadRatio(85))
+	watcher, ok := counterRecorder.(thresholdWatcher)
+	require.True(ok)
+	watcher.addThreshold(85)
+	counterRecorder.AddRecord(90)
+	require.Equal(1.0/20, counterRecorder.GetLoadRatio(85))
+}
+
+func TestAsymmetricIntensityRamp(t *testing.T) {
+	require := require.New(t)
+	mp := massagePlan{
+		opts: options{
+			cpusageCollector:     collectorFunc(func() float64 { return 0 }),
+			highLoadThreshold:    80,
+			loadStatusJudgeRatio: 0.2,
+			initialIntensity:     50,
+			stepIntensity:        1,
+			checkPeriodInSeconds: 3,
+			recorder:             NewCounterRecorder(10),
+		},
+		currentState: stateRelaxed{},
+	}
+	WithAsymmetricStepIntensity(20, 2)(&mp.opts)
+	WithAsymmetricCheckPeriodInSeconds(1, 10)(&mp.opts)
+	require.True(mp.opts.isValid())
+	startTime := time.Now()
+	mp.currentCPUsageRecordTime = startTime
+	mp.SetTired()
+	addRecordAt := func(cpusage float64, d time.Duration) {
+		mp.opts.recorder.AddRecord(cpusage)
+		mp.currentCPUsageRecordTime = startTime.Add(d)
+		mp.currentState.AddACPUsageRecord(&mp)
+	}
+
+	// 负荷升高时按照较短的检查周期大步提高按摩力度
+	addRecordAt(90, 500*time.Millisecond)
+	require.Equal(uint(50), mp.currentIntensity)
+	addRecordAt(90, 2*time.Second)
+	require.Equal(uint(70), mp.currentIntensity)
+
+	// 负荷回落时按照较长的检查周期小步降低按摩力度
+	addRecordAt(50, 5*time.Second)
+	require.Equal(uint(70), mp.currentIntensity)
+	addRecordAt(50, 13*time.Second)
+	require.Equal(uint(68), mp.currentIntensity)
+
+	addRecordAt(90, 14500*time.Millisecond)
+	require.Equal(uint(88), mp.currentIntensity)
+
+	// 降低的检查周期还没有到期的时候不更新高负荷占比的基准，短暂的回落再回升不算升高
+	addRecordAt(50, 15*time.Second)
+	require.Equal(uint(88), mp.currentIntensity)
+	addRecordAt(90, 16*time.Second)
+	require.Equal(uint(88), mp.currentIntensity)
+	// 降低按摩力度比较的是上次调整按摩力度时的高负荷占比
+	addRecordAt(50, 25*time.Second)
+	require.Equal(uint(86), mp.currentIntensity)
+
+	// 乘性降低按摩力度
+	WithMultiplicativeDecrease(0.5)(&mp.opts)
+	require.True(mp.opts.isValid())
+	mp.DecreaseIntensity()
+	require.Equal(uint(43), mp.currentIntensity)
+	for i := 0; i < 6; i++ {
+		mp.DecreaseIntensity()
+	}
+	require.Equal(uint(emptyIntensity), mp.currentIntensity)
+	mp.DecreaseIntensity()
+	require.True(mp.isRelaxed())
+}
@@ -0,0 +1,236 @@
+package cpumassager
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// WaitOrder 等待队列放行等待者的顺序
+type WaitOrder int
+
+const (
+	// WaitOrderFIFO 先进先出，等待最久的先放行，是默认的顺序
+	WaitOrderFIFO WaitOrder = iota
+	// WaitOrderLIFO 后进先出，最新的等待者先放行，过载持续的时候等待久的调用方多半已经快超时了，
+	// 优先放行新的等待者可以让更多的请求在超时之前得到处理
+	WaitOrderLIFO
+)
+
+const (
+	// maxWaitQueueLength 等待队列最多可以设定的长度
+	maxWaitQueueLength = 100000
+	// maxWaitTime 最长可以设定的等待时间
+	maxWaitTime = time.Minute
+	// waitDispatchInterval 等待队列非空时按照按摩力度重新放行等待者的间隔
+	waitDispatchInterval = 10 * time.Millisecond
+)
+
+var (
+	// ErrWaitTimeout Wait在等待队列中等待超过最长等待时间依然没有被放行
+	ErrWaitTimeout = errors.New("cpumassager: wait timeout")
+	// ErrWaitQueueFull Wait需要排队但是等待队列已满
+	ErrWaitQueueFull = errors.New("cpumassager: wait queue is full")
+	// ErrWaitRejected 没有设定等待队列，Wait需要拒绝服务的时候直接返回
+	ErrWaitRejected = errors.New("cpumassager: wait rejected without wait queue")
+)
+
+// waiter 等待队列中的一个等待者，被放行的时候关闭readyChan
+type waiter struct {
+	readyChan chan struct{}
+	// elem 等待者在队列中的位置，被放行或者移出队列之后为nil
+	elem *list.Element
+}
+
+// waitQueue 有界的等待队列，需要拒绝服务的时候让调用方排队等待，按照按摩力度允许的比例放行，
+// 和按摩计划一样以待处理、已处理任务计数，新的任务到达带来的余量优先分给等待者；另外队头的
+// 等待者可以随时间提前占用下一个任务到达才会带来的余量，避免到达很稀疏的时候有余量也要等到
+// 超时，但是放行的总数最多只比按摩力度允许的多一个。按摩力度为0的时候放行全部等待者
+type waitQueue struct {
+	mu        sync.Mutex
+	order     WaitOrder
+	maxLength int
+	maxWait   time.Duration
+	// intensity 获取当前实际生效的按摩力度
+	intensity func() uint
+
+	waiters *list.List
+	// todoTasks、doneTasks 待处理、已处理任务，在按摩计划清空工作区的时候清空
+	todoTasks uint64
+	doneTasks uint64
+	// headCredit 队头的等待者随时间累积的提前占用余量的机会，达到1并且还可以提前占用的时候
+	// 放行一个等待者，lastDispatchTime 上一次累积的时间，队列为空的时候清零
+	headCredit       float64
+	lastDispatchTime time.Time
+	// dispatching 是否已经安排了下一次放行
+	dispatching bool
+
+	now func() time.Time
+}
+
+func newWaitQueue(order WaitOrder, maxLength int, maxWait time.Duration, intensity func() uint) *waitQueue {
+	return &waitQueue{
+		order:     order,
+		maxLength: maxLength,
+		maxWait:   maxWait,
+		intensity: intensity,
+		waiters:   list.New(),
+		now:       time.Now,
+	}
+}
+
+// reset 清空待处理、已处理任务，排队中的等待者保留
+func (q *waitQueue) reset() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.todoTasks = 0
+	q.doneTasks = 0
+}
+
+// admit 按照按摩力度判断是否还有余量放行一个任务，需要持有mu
+func (q *waitQueue) admit(intensity uint) bool {
+	requireTasks := q.todoTasks * (fullIntensity - uint64(intensity)) / fullIntensity
+	if intensity == emptyIntensity || q.doneTasks < requireTasks {
+		q.doneTasks++
+		return true
+	}
+	return false
+}
+
+// canBorrow 已处理任务是否还没有超过按摩力度允许的任务数加一，也就是还可以提前占用下一个
+// 任务到达才会带来的余量，需要持有mu
+func (q *waitQueue) canBorrow(intensity uint) bool {
+	return q.doneTasks*fullIntensity < q.todoTasks*(fullIntensity-uint64(intensity))+fullIntensity
+}
+
+// tryAdmit 记录一个新的任务，没有人在排队并且有余量的话直接放行
+func (q *waitQueue) tryAdmit(intensity uint) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.todoTasks++
+	return q.waiters.Len() == 0 && q.admit(intensity)
+}
+
+// push 把一个等待者加入队列，队列已满则返回ErrWaitQueueFull
+func (q *waitQueue) push() (*waiter, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.waiters.Len() >= q.maxLength {
+		return nil, ErrWaitQueueFull
+	}
+	if q.waiters.Len() == 0 {
+		q.headCredit = 0
+		q.lastDispatchTime = q.now()
+	}
+	w := &waiter{readyChan: make(chan struct{})}
+	w.elem = q.waiters.PushBack(w)
+	q.scheduleDispatch()
+	return w, nil
+}
+
+// remove 把等待者移出队列，等待者已经被放行则返回false
+func (q *waitQueue) remove(w *waiter) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if w.elem == nil {
+		return false
+	}
+	q.waiters.Remove(w.elem)
+	w.elem = nil
+	return true
+}
+
+// dispatch 按照放行顺序放行有余量的等待者，新的任务到达带来的余量用完之后，队头的等待者按照
+// 从上一次放行到now累积的机会提前占用下一个余量，需要持有mu
+func (q *waitQueue) dispatch(intensity uint, now time.Time) {
+	if elapsed := now.Sub(q.lastDispatchTime); elapsed > 0 {
+		q.headCredit += float64(elapsed) / float64(waitDispatchInterval) *
+			float64(fullIntensity-intensity) / fullIntensity
+		q.lastDispatchTime = now
+	}
+	for q.waiters.Len() > 0 {
+		if !q.admit(intensity) {
+			if q.headCredit < 1 || !q.canBorrow(intensity) {
+				break
+			}
+			q.headCredit--
+			q.doneTasks++
+		}
+		elem := q.waiters.Front()
+		if q.order == WaitOrderLIFO {
+			elem = q.waiters.Back()
+		}
+		w := q.waiters.Remove(elem).(*waiter)
+		w.elem = nil
+		close(w.readyChan)
+	}
+	if q.waiters.Len() == 0 {
+		q.headCredit = 0
+	} else if q.headCredit > 1 {
+		q.headCredit = 1
+	}
+}
+
+// scheduleDispatch 等待队列非空的时候每隔waitDispatchInterval按照按摩力度放行等待者，需要持有mu
+func (q *waitQueue) scheduleDispatch() {
+	if q.dispatching || q.waiters.Len() == 0 {
+		return
+	}
+	q.dispatching = true
+	time.AfterFunc(waitDispatchInterval, func() {
+		intensity := q.intensity()
+		q.mu.Lock()
+		defer q.mu.Unlock()
+		q.dispatching = false
+		q.dispatch(intensity, q.now())
+		q.scheduleDispatch()
+	})
+}
+
+// Wait 和NeedMassage一样判断是否需要拒绝服务，但是需要拒绝服务的时候不是立即返回，而是在
+// 等待队列中排队，按照按摩力度允许的比例放行，放行则返回nil；等待超过最长等待时间返回
+// ErrWaitTimeout，队列已满返回ErrWaitQueueFull，ctx结束则返回ctx.Err()。没有设定
+// WithWaitQueue的话不排队，需要拒绝服务时直接返回ErrWaitRejected
+func (p *massagePlan) Wait(ctx context.Context) error {
+	intensity := p.getIntensity()
+	if err := ctx.Err(); err != nil {
+		p.finishDecision(intensity, true)
+		return err
+	}
+	if p.waitQueue == nil {
+		if p.NeedMassage() {
+			return ErrWaitRejected
+		}
+		return nil
+	}
+	if p.waitQueue.tryAdmit(intensity) {
+		p.finishDecision(intensity, false)
+		return nil
+	}
+	if p.isDryRun() {
+		p.finishDecision(intensity, true)
+		return nil
+	}
+	w, err := p.waitQueue.push()
+	if err != nil {
+		p.finishDecision(intensity, true)
+		return err
+	}
+	timer := time.NewTimer(p.waitQueue.maxWait)
+	defer timer.Stop()
+	select {
+	case <-w.readyChan:
+	case <-timer.C:
+		err = ErrWaitTimeout
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	if err != nil && p.waitQueue.remove(w) {
+		p.finishDecision(intensity, true)
+		return err
+	}
+	p.finishDecision(intensity, false)
+	return nil
+}
@@ -0,0 +1,183 @@
+package cpumassager
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWaitQueueDispatch(t *testing.T) {
+	require := require.New(t)
+	for _, order := range []WaitOrder{WaitOrderFIFO, WaitOrderLIFO} {
+		q := newWaitQueue(order, 3, time.Minute, func() uint { return fullIntensity })
+		now := time.Now()
+		q.now = func() time.Time { return now }
+		var waiters []*waiter
+		for i := 0; i < 3; i++ {
+			require.False(q.tryAdmit(fullIntensity))
+			w, err := q.push()
+			require.NoError(err)
+			waiters = append(waiters, w)
+		}
+		_, err := q.push()
+		require.Equal(ErrWaitQueueFull, err)
+
+		// 按摩力度为50的时候放行一半的任务，按照放行顺序放行
+		q.mu.Lock()
+		q.dispatch(50, now)
+		q.mu.Unlock()
+		released := waiters[0]
+		if order == WaitOrderLIFO {
+			released = waiters[2]
+		}
+		require.False(q.remove(released))
+		require.Equal(2, q.waiters.Len())
+		for _, w := range waiters {
+			if w != released {
+				require.True(q.remove(w))
+			}
+		}
+	}
+
+	// 没有新的任务到达的时候，队头的等待者随时间提前占用下一个余量，但是放行的总数最多只比
+	// 按摩力度允许的多一个
+	q := newWaitQueue(WaitOrderFIFO, 10, time.Minute, func() uint { return fullIntensity })
+	now := time.Now()
+	q.now = func() time.Time { return now }
+	for i := 0; i < 4; i++ {
+		require.False(q.tryAdmit(fullIntensity))
+		_, err := q.push()
+		require.NoError(err)
+	}
+	q.mu.Lock()
+	q.dispatch(50, now)
+	require.Equal(2, q.waiters.Len())
+	q.dispatch(50, now.Add(waitDispatchInterval))
+	require.Equal(2, q.waiters.Len())
+	q.dispatch(50, now.Add(2*waitDispatchInterval))
+	require.Equal(1, q.waiters.Len())
+	q.dispatch(50, now.Add(time.Second))
+	require.Equal(1, q.waiters.Len())
+	require.Equal(uint64(3), q.doneTasks)
+	q.mu.Unlock()
+
+	// 按摩力度降为0之后定期放行全部等待者
+	var intensity uint32 = fullIntensity
+	q = newWaitQueue(WaitOrderFIFO, 10, time.Minute, func() uint { return uint(atomic.LoadUint32(&intensity)) })
+	var waiters []*waiter
+	for i := 0; i < 3; i++ {
+		w, err := q.push()
+		require.NoError(err)
+		waiters = append(waiters, w)
+	}
+	time.Sleep(3 * waitDispatchInterval)
+	require.Equal(3, q.waiters.Len())
+	atomic.StoreUint32(&intensity, emptyIntensity)
+	for _, w := range waiters {
+		select {
+		case <-w.readyChan:
+		case <-time.After(time.Second):
+			require.Fail("waiter should be released")
+		}
+	}
+}
+
+func TestWait(t *testing.T) {
+	require := require.New(t)
+	mp := massagePlan{
+		opts: options{
+			cpusageCollector:     collectorFunc(func() float64 { return 0 }),
+			loadStatusJudgeRatio: 0.2,
+			initialIntensity:     50,
+		},
+		currentState: stateRelaxed{},
+	}
+	// 没有设定等待队列的时候不排队
+	require.NoError(mp.Wait(context.Background()))
+	mp.SetTired()
+	require.Equal(ErrWaitRejected, mp.Wait(context.Background()))
+	require.NoError(mp.Wait(context.Background()))
+
+	WithWaitQueue(WaitOrderFIFO, 2, 200*time.Millisecond)(&mp.opts)
+	require.True(mp.opts.isValid())
+	mp.waitQueue = newWaitQueue(mp.opts.waitOrder, mp.opts.maxWaitQueueLength, mp.opts.maxWaitTime, mp.getIntensity)
+	mp.SetTired()
+	mp.rejectStats = RejectStats{}
+
+	// 按摩力度为50，两个排队的调用方一个随时间提前占用下一个余量放行，另一个使用自己到达带来的余量放行
+	results := make(chan error, 2)
+	go func() { results <- mp.Wait(context.Background()) }()
+	time.Sleep(5 * time.Millisecond)
+	go func() { results <- mp.Wait(context.Background()) }()
+	require.NoError(<-results)
+	require.NoError(<-results)
+
+	// 串行调用的时候还可以再提前占用一次，之后没有新的任务到达带来余量就等待超时
+	require.NoError(mp.Wait(context.Background()))
+	require.Equal(ErrWaitTimeout, mp.Wait(context.Background()))
+	require.Equal(RejectStats{Requests: 4, Rejected: 1}, mp.GetRejectStats())
+
+	// 到达很稀疏的时候依然按照按摩力度允许的比例放行：按摩力度为80，每秒到达20个调用方
+	low := massagePlan{
+		opts: options{
+			cpusageCollector:     collectorFunc(func() float64 { return 0 }),
+			loadStatusJudgeRatio: 0.2,
+			initialIntensity:     80,
+		},
+		currentState: stateTired{},
+	}
+	WithWaitQueue(WaitOrderFIFO, 100, 200*time.Millisecond)(&low.opts)
+	low.waitQueue = newWaitQueue(low.opts.waitOrder, low.opts.maxWaitQueueLength, low.opts.maxWaitTime, low.getIntensity)
+	low.SetTired()
+	lowResults := make(chan error, 40)
+	for i := 0; i < 40; i++ {
+		go func() { lowResults <- low.Wait(context.Background()) }()
+		time.Sleep(50 * time.Millisecond)
+	}
+	admitted := 0
+	for i := 0; i < 40; i++ {
+		if <-lowResults == nil {
+			admitted++
+		}
+	}
+	// 按摩力度允许放行8个，提前占用余量最多多放行一个
+	require.InDelta(8, admitted, 1)
+
+	// 队列已满的时候直接返回，ctx结束的时候返回ctx.Err()
+	full := massagePlan{
+		opts: options{
+			cpusageCollector:     collectorFunc(func() float64 { return 0 }),
+			loadStatusJudgeRatio: 0.2,
+			initialIntensity:     fullIntensity,
+		},
+		currentState: stateTired{},
+	}
+	WithWaitQueue(WaitOrderLIFO, 2, time.Minute)(&full.opts)
+	full.waitQueue = newWaitQueue(full.opts.waitOrder, full.opts.maxWaitQueueLength, full.opts.maxWaitTime, full.getIntensity)
+	full.SetTired()
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() { results <- full.Wait(ctx) }()
+	go func() { results <- full.Wait(ctx) }()
+	time.Sleep(5 * time.Millisecond)
+	require.Equal(ErrWaitQueueFull, full.Wait(context.Background()))
+	cancel()
+	require.Equal(context.Canceled, <-results)
+	require.Equal(context.Canceled, <-results)
+	require.Equal(context.Canceled, full.Wait(ctx))
+
+	// 试运行模式下不排队
+	full.SetDryRun(true)
+	require.NoError(full.Wait(context.Background()))
+	require.Equal(RejectStats{Requests: 5, Rejected: 4, WouldRejected: 1}, full.GetRejectStats())
+
+	invalid := options{cpusageCollector: collectorFunc(func() float64 { return 0 }), loadStatusJudgeRatio: 0.2}
+	WithWaitQueue(WaitOrderLIFO, 10, 0)(&invalid)
+	require.False(invalid.isValid())
+	WithWaitQueue(WaitOrder(2), 10, time.Second)(&invalid)
+	require.False(invalid.isValid())
+	WithWaitQueue(WaitOrderFIFO, -1, time.Second)(&invalid)
+	require.False(invalid.isValid())
+}
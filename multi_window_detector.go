@@ -0,0 +1,73 @@
+package cpumassager
+
+import (
+	"fmt"
+	"time"
+)
+
+// multiWindowDetector 多窗口负荷检测器，参照SRE中多窗口燃烧率告警的做法，
+// 短窗口非常热(突发的尖峰)或者长窗口比较热(缓慢的爬升)都认为是高负荷，
+// 只有两个窗口都不热的时候才允许从疲累状态恢复到轻松状态
+type multiWindowDetector struct {
+	// shortWindow 短窗口的时长，例如5秒
+	shortWindow time.Duration
+	// shortRatio 短窗口内高负荷记录的占比超过该值则认为短窗口热，例如0.9
+	shortRatio float64
+	// longWindow 长窗口的时长，例如60秒
+	longWindow time.Duration
+	// longRatio 长窗口内高负荷记录的占比超过该值则认为长窗口热，例如0.5
+	longRatio float64
+
+	recorder *SlidingWindowRecorder
+}
+
+func newMultiWindowDetector(shortWindow time.Duration, shortRatio float64,
+	longWindow time.Duration, longRatio float64) *multiWindowDetector {
+	d := &multiWindowDetector{
+		shortWindow: shortWindow,
+		shortRatio:  shortRatio,
+		longWindow:  longWindow,
+		longRatio:   longRatio,
+	}
+	// 每秒记录一次，多保留一条记录以覆盖整个长窗口
+	size := int(longWindow/time.Second) + 1
+	if size > 0 {
+		d.recorder, _ = NewSlidingWindowRecorder(size)
+	}
+	return d
+}
+
+// isValid 用来判断多窗口检测器的参数是否合法
+func (d *multiWindowDetector) isValid() error {
+	if d.shortWindow < time.Second || d.shortWindow >= d.longWindow {
+		return fmt.Errorf("shortWindow should in [1s, longWindow)")
+	}
+	if d.longWindow > maxRecordCap*time.Second {
+		return fmt.Errorf("longWindow should not greater than:%ds", maxRecordCap)
+	}
+	if d.shortRatio <= 0 || d.shortRatio > 1 || d.longRatio <= 0 || d.longRatio > 1 {
+		return fmt.Errorf("shortRatio and longRatio should in (0, 1]")
+	}
+	return nil
+}
+
+// AddRecord 添加一条CPU使用率的记录
+func (d *multiWindowDetector) AddRecord(cpusage float64) {
+	d.recorder.AddRecord(cpusage)
+}
+
+// isShortWindowHot 短窗口内CPU使用率>=threshold的占比是否超过shortRatio，占比按照短窗口内
+// 应有的记录数计算，一条尖峰记录不会让短窗口变热
+func (d *multiWindowDetector) isShortWindowHot(threshold float64) bool {
+	return d.recorder.GetLoadRatioWithin(threshold, d.shortWindow) > d.shortRatio
+}
+
+// isLongWindowHot 长窗口内CPU使用率>=threshold的占比是否超过longRatio
+func (d *multiWindowDetector) isLongWindowHot(threshold float64) bool {
+	return d.recorder.GetLoadRatioWithin(threshold, d.longWindow) > d.longRatio
+}
+
+// isHighLoad 任意一个窗口热就认为是高负荷
+func (d *multiWindowDetector) isHighLoad(threshold float64) bool {
+	return d.isShortWindowHot(threshold) || d.isLongWindowHot(threshold)
+}
@@ -0,0 +1,127 @@
+package cpumassager
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestMultiWindowDetector 新建一个使用模拟时钟的多窗口检测器，每添加一条记录时钟前进1秒
+func newTestMultiWindowDetector() (*multiWindowDetector, func(cpusage float64)) {
+	d := newMultiWindowDetector(5*time.Second, 0.8, 60*time.Second, 0.5)
+	now := time.Now()
+	d.recorder.now = func() time.Time { return now }
+	return d, func(cpusage float64) {
+		now = now.Add(time.Second)
+		d.AddRecord(cpusage)
+	}
+}
+
+func TestMultiWindowDetectorIsValid(t *testing.T) {
+	assert := assert.New(t)
+	assert.Nil(newMultiWindowDetector(5*time.Second, 0.9, time.Minute, 0.5).isValid())
+	assert.NotNil(newMultiWindowDetector(0, 0.9, time.Minute, 0.5).isValid())
+	assert.NotNil(newMultiWindowDetector(time.Minute, 0.9, time.Minute, 0.5).isValid())
+	assert.NotNil(newMultiWindowDetector(5*time.Second, 0.9, 2*time.Hour, 0.5).isValid())
+	assert.NotNil(newMultiWindowDetector(5*time.Second, 0, time.Minute, 0.5).isValid())
+	assert.NotNil(newMultiWindowDetector(5*time.Second, 0.9, time.Minute, 1.1).isValid())
+}
+
+func TestMultiWindowDetector(t *testing.T) {
+	assert := assert.New(t)
+
+	// 记录还不够的时候一条尖峰记录不会让短窗口变热
+	d, addRecord := newTestMultiWindowDetector()
+	addRecord(100)
+	assert.False(d.isShortWindowHot(80))
+	assert.False(d.isHighLoad(80))
+
+	// 突发的尖峰很快就会让短窗口变热
+	d, addRecord = newTestMultiWindowDetector()
+	for i := 0; i < 60; i++ {
+		addRecord(30)
+	}
+	for i := 0; i < 5; i++ {
+		addRecord(100)
+	}
+	assert.True(d.isShortWindowHot(80))
+	assert.False(d.isLongWindowHot(80))
+	assert.True(d.isHighLoad(80))
+
+	// 缓慢的爬升短窗口不够热，但是长窗口会变热
+	d, addRecord = newTestMultiWindowDetector()
+	for i := 0; i < 60; i++ {
+		if i%3 == 0 {
+			addRecord(50)
+		} else {
+			addRecord(85)
+		}
+	}
+	assert.False(d.isShortWindowHot(80))
+	assert.True(d.isLongWindowHot(80))
+	assert.True(d.isHighLoad(80))
+
+	// 两个窗口都不热
+	for i := 0; i < 60; i++ {
+		addRecord(50)
+	}
+	assert.False(d.isHighLoad(80))
+}
+
+func TestMassagePlanWithMultiWindow(t *testing.T) {
+	require := require.New(t)
+	d, _ := newTestMultiWindowDetector()
+	now := time.Now()
+	d.recorder.now = func() time.Time { return now }
+	cpusage := 100.0
+	mp := massagePlan{
+		opts: options{
+			cpusageCollector:     collectorFunc(func() float64 { return cpusage }),
+			highLoadThreshold:    80,
+			loadStatusJudgeRatio: 0.2,
+			initialIntensity:     10,
+			stepIntensity:        10,
+			multiWindowDetector:  d,
+		},
+		currentState: stateRelaxed{},
+	}
+	addRecord := func() {
+		now = now.Add(time.Second)
+		mp.AddACPUsageRecord()
+	}
+
+	// 短窗口热，不需要等计数器记录器积累20秒就进入疲累状态，但是需要短窗口内的记录都是高负荷
+	for i := 0; i < 4; i++ {
+		addRecord()
+		require.True(mp.isRelaxed())
+	}
+	addRecord()
+	require.True(mp.isTired())
+
+	// 长窗口依然热，按摩力度降为0也不会回到轻松状态
+	for i := 0; i < 30; i++ {
+		addRecord()
+	}
+	require.Equal(uint(fullIntensity), mp.currentIntensity)
+	cpusage = 10
+	for i := 0; i < 15; i++ {
+		addRecord()
+	}
+	require.Equal(uint(emptyIntensity), mp.currentIntensity)
+	require.True(mp.isTired())
+
+	// 两个窗口都不热之后才会回到轻松状态
+	for i := 0; i < 60; i++ {
+		addRecord()
+	}
+	require.True(mp.isRelaxed())
+}
+
+// collectorFunc 用函数实现的CPU使用率收集器
+type collectorFunc func() float64
+
+func (f collectorFunc) GetCPUsage() float64 {
+	return f()
+}
@@ -0,0 +1,95 @@
+package cpumassager
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// RejectPattern 疲累状态下NeedMassage按照按摩力度拒绝服务的方式
+type RejectPattern int
+
+const (
+	// RejectPatternCounter 按照待处理、已处理任务数的计数拒绝，拒绝的分布最均匀，
+	// 计数只在按摩力度变化时清空，安静一段时间之后积累的余量可能放进一波突发请求，
+	// 并且重试的请求容易和拒绝的位置对齐，是默认的方式
+	RejectPatternCounter RejectPattern = iota
+	// RejectPatternBernoulli 每个请求以按摩力度为概率独立随机地拒绝，重试的请求不会被连续拒绝
+	RejectPatternBernoulli
+	// RejectPatternSlidingWindow 只按照最近1秒内的待处理、已处理任务数拒绝，不会积累余量
+	RejectPatternSlidingWindow
+)
+
+const (
+	rejectWindowBuckets        = 10
+	rejectWindowBucketDuration = time.Second / rejectWindowBuckets
+)
+
+// rejecter 按照按摩力度判断疲累状态下是否可以处理一个请求，为nil则使用按摩计划的计数方式
+type rejecter interface {
+	canDoWork(intensity uint) bool
+}
+
+// newRejecter 按照拒绝方式新建rejecter，seed是RejectPatternBernoulli使用的随机数种子
+func newRejecter(pattern RejectPattern, seed int64) rejecter {
+	switch pattern {
+	case RejectPatternBernoulli:
+		return &bernoulliRejecter{rand: rand.New(rand.NewSource(seed))}
+	case RejectPatternSlidingWindow:
+		return &windowRejecter{now: time.Now}
+	}
+	return nil
+}
+
+// bernoulliRejecter 以按摩力度为概率随机拒绝
+type bernoulliRejecter struct {
+	mu   sync.Mutex
+	rand *rand.Rand
+}
+
+func (r *bernoulliRejecter) canDoWork(intensity uint) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.rand.Float64()*fullIntensity >= float64(intensity)
+}
+
+// rejectWindowBucket 滑动窗口中一个时间片的待处理、已处理任务数
+type rejectWindowBucket struct {
+	index     int64
+	todoTasks uint64
+	doneTasks uint64
+}
+
+// windowRejecter 把最近1秒分成若干个时间片，只按照窗口内的待处理、已处理任务数拒绝
+type windowRejecter struct {
+	mu      sync.Mutex
+	buckets [rejectWindowBuckets]rejectWindowBucket
+	now     func() time.Time
+}
+
+func (r *windowRejecter) canDoWork(intensity uint) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	index := r.now().UnixNano() / int64(rejectWindowBucketDuration)
+	bucket := &r.buckets[index%rejectWindowBuckets]
+	if bucket.index != index {
+		*bucket = rejectWindowBucket{index: index}
+	}
+	bucket.todoTasks++
+
+	var todoTasks, doneTasks uint64
+	for _, b := range r.buckets {
+		if index-b.index < rejectWindowBuckets {
+			todoTasks += b.todoTasks
+			doneTasks += b.doneTasks
+		}
+	}
+	// 需要完成的任务数四舍五入，否则流量很小的时候窗口内的待处理任务数太少，
+	// 向下取整之后按摩力度再小也会拒绝全部请求
+	requireTasks := (todoTasks*(fullIntensity-uint64(intensity)) + fullIntensity/2) / fullIntensity
+	if doneTasks < requireTasks {
+		bucket.doneTasks++
+		return true
+	}
+	return false
+}
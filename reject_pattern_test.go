@@ -0,0 +1,96 @@
+package cpumassager
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBernoulliRejecter(t *testing.T) {
+	require := require.New(t)
+	require.Nil(newRejecter(RejectPatternCounter, 1))
+	countDone := func(r rejecter, intensity uint) int {
+		done := 0
+		for i := 0; i < 10000; i++ {
+			if r.canDoWork(intensity) {
+				done++
+			}
+		}
+		return done
+	}
+	r := newRejecter(RejectPatternBernoulli, 1)
+	require.InDelta(7000, countDone(r, 30), 200)
+	require.Equal(0, countDone(r, fullIntensity))
+	require.Equal(10000, countDone(r, emptyIntensity))
+
+	// 相同的种子得到相同的拒绝序列
+	r1, r2 := newRejecter(RejectPatternBernoulli, 42), newRejecter(RejectPatternBernoulli, 42)
+	for i := 0; i < 100; i++ {
+		require.Equal(r1.canDoWork(50), r2.canDoWork(50))
+	}
+}
+
+func TestWindowRejecter(t *testing.T) {
+	require := require.New(t)
+	r := newRejecter(RejectPatternSlidingWindow, 0).(*windowRejecter)
+	now := time.Now()
+	r.now = func() time.Time { return now }
+
+	done := 0
+	for i := 0; i < 100; i++ {
+		if r.canDoWork(50) {
+			done++
+		}
+	}
+	require.Equal(50, done)
+
+	// 安静一段时间之后不会积累余量，突发的请求依然按照按摩力度拒绝
+	now = now.Add(5 * time.Second)
+	done = 0
+	for i := 0; i < 100; i++ {
+		if r.canDoWork(80) {
+			done++
+		}
+	}
+	require.Equal(20, done)
+
+	// 流量很小的时候，按摩力度很小不会拒绝全部请求，按摩力度很大依然会拒绝
+	for _, c := range []struct {
+		intensity uint
+		done      int
+	}{{1, 10}, {40, 10}, {60, 0}, {99, 0}} {
+		done = 0
+		for i := 0; i < 10; i++ {
+			now = now.Add(time.Second)
+			if r.canDoWork(c.intensity) {
+				done++
+			}
+		}
+		require.Equal(c.done, done, "intensity:%d", c.intensity)
+	}
+}
+
+func TestMassagePlanWithRejectPattern(t *testing.T) {
+	require := require.New(t)
+	mp := massagePlan{
+		opts: options{
+			cpusageCollector:     collectorFunc(func() float64 { return 0 }),
+			loadStatusJudgeRatio: 0.2,
+			initialIntensity:     fullIntensity,
+		},
+		currentState: stateRelaxed{},
+	}
+	WithRejectPattern(RejectPatternBernoulli)(&mp.opts)
+	WithRandomSeed(1)(&mp.opts)
+	require.True(mp.opts.isValid())
+	require.Equal(int64(1), mp.opts.getRandomSeed())
+	mp.rejecter = newRejecter(mp.opts.rejectPattern, mp.opts.getRandomSeed())
+	require.False(mp.NeedMassage())
+	mp.SetTired()
+	require.True(mp.NeedMassage())
+	require.Equal(uint64(0), mp.todoTaskNum())
+
+	WithRejectPattern(RejectPatternSlidingWindow + 1)(&mp.opts)
+	require.False(mp.opts.isValid())
+}